@@ -14,6 +14,7 @@ import (
 const (
 	LOGFILE       = "/root/hits.sql"
 	SITUATION_URL = "http://192.168.10.1/getSituation"
+	TEMP_INTERVAL = 1 * time.Minute // Enclosure temperature update rate.
 )
 
 type MySituation struct {
@@ -71,7 +72,7 @@ func main() {
 	// Start the GPS logging functions in the background.
 	situationMutex = &sync.Mutex{}
 
-	rfm95w, err := goRFM95W.New(nil)
+	rfm95w, err := goRFM95W.New(nil, nil)
 	chkErr(err)
 
 	go situationUpdater() // Keep the GPS location updated.
@@ -79,7 +80,21 @@ func main() {
 	rfm95w.Start()
 
 	i := 0
+	temp := "unknown"
+	var tempRead time.Time
 	for {
+		// Enclosure temperature. Read between parameter changes: the module switches to FSK for the reading, which
+		// would abort a packet being received.
+		if time.Since(tempRead) >= TEMP_INTERVAL {
+			t, err := rfm95w.ReadTemperature()
+			if err != nil {
+				fmt.Printf("temperature error: %s\n", err.Error())
+			} else {
+				temp = fmt.Sprintf("%d C", t)
+				tempRead = time.Now()
+			}
+		}
+
 		param := testParams[i]
 		fmt.Printf("%d %v\n", i, param)
 		err := rfm95w.SetParams(param)
@@ -96,7 +111,7 @@ func main() {
 				msgs := rfm95w.FlushRXBuffer()
 				if len(msgs) > 0 {
 					for _, msg := range msgs {
-						fmt.Printf("%f,%f,%f,%s,%d dBm,%f dB,%0.3f MHz,%0.3f kHz,%d,%d,%d,%s\n", Location.GPSLatitude, Location.GPSLongitude, Location.GPSAltitudeMSL, Location.GPSTime, msg.RSSI, msg.SNR, float32(msg.Params.Frequency)/float32(1000000.0), float32(msg.Params.Bandwidth)/float32(1000.0), msg.Params.SpreadingFactor, msg.Params.CodingRate, msg.Params.PreambleLength, msg.Buf)
+						fmt.Printf("%f,%f,%f,%s,%d dBm,%f dB,%0.3f MHz,%0.3f kHz,%d,%d,%d,%s,%s\n", Location.GPSLatitude, Location.GPSLongitude, Location.GPSAltitudeMSL, Location.GPSTime, msg.RSSI, msg.SNR, float32(msg.Params.Frequency)/float32(1000000.0), float32(msg.Params.Bandwidth)/float32(1000.0), msg.Params.SpreadingFactor, msg.Params.CodingRate, msg.Params.PreambleLength, temp, msg.Buf)
 					}
 					// Got a message. Move on to the next parameter.
 					i++
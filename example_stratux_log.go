@@ -70,7 +70,7 @@ func situationUpdater() {
 func main() {
 	situationMutex = &sync.Mutex{}
 
-	rfm95w, err := goRFM95W.New(nil)
+	rfm95w, err := goRFM95W.New(nil, nil)
 	chkErr(err)
 
 	go situationUpdater() // Keep the GPS location updated.
@@ -8,7 +8,7 @@ import (
 )
 
 func main() {
-	rfm95w, err := goRFM95W.New(nil)
+	rfm95w, err := goRFM95W.New(nil, nil)
 	if err != nil {
 		fmt.Printf("error: %s\n", err.Error())
 		return
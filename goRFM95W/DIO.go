@@ -0,0 +1,204 @@
+// DIO line mapping and interrupt handling.
+
+package goRFM95W
+
+import (
+	"time"
+)
+
+// RegDioMapping1/2 values per line. LoRa mode.
+const (
+	RF95W_DIO0_RXDONE = 0x0
+	RF95W_DIO0_TXDONE = 0x1
+
+	RF95W_DIO1_RXTIMEOUT   = 0x0
+	RF95W_DIO1_CADDETECTED = 0x2
+
+	RF95W_DIO3_CADDONE         = 0x0
+	RF95W_DIO3_VALIDHEADER     = 0x1
+	RF95W_DIO3_PAYLOADCRCERROR = 0x2
+
+	RF95W_DIO4_CADDETECTED = 0x0
+	RF95W_DIO4_PLLLOCK     = 0x1
+
+	RF95W_DIO5_MODEREADY = 0x0
+	RF95W_DIO5_CLKOUT    = 0x1
+)
+
+// RegDioMapping1/2 values per line. FSK/OOK packet mode.
+const (
+	RF95W_FSK_DIO0_PACKETSENT   = 0x0 // TX.
+	RF95W_FSK_DIO0_PAYLOADREADY = 0x0 // RX.
+	RF95W_FSK_DIO0_CRCOK        = 0x1
+	RF95W_FSK_DIO0_TEMPCHANGE   = 0x3
+
+	RF95W_FSK_DIO2_RXREADY     = 0x1
+	RF95W_FSK_DIO2_TIMEOUT     = 0x2
+	RF95W_FSK_DIO2_SYNCADDRESS = 0x3
+
+	RF95W_FSK_DIO3_TXREADY = 0x1
+
+	RF95W_FSK_DIO4_TEMPCHANGE = 0x0
+	RF95W_FSK_DIO4_PLLLOCK    = 0x1
+	RF95W_FSK_DIO4_TIMEOUT    = 0x2
+	RF95W_FSK_DIO4_MODEREADY  = 0x3
+
+	RF95W_FSK_DIO5_CLKOUT    = 0x0
+	RF95W_FSK_DIO5_PLLLOCK   = 0x1
+	RF95W_FSK_DIO5_DATA      = 0x2
+	RF95W_FSK_DIO5_MODEREADY = 0x3
+)
+
+const (
+	RF95W_RX_DEFER_CHECK = 10 * time.Millisecond // How often to re-check a reception that is holding up TX.
+)
+
+/*
+	RFM95W_DIOMapping.
+	 Mapping of DIO1-DIO5 (RF95W_DIOx_* or RF95W_FSK_DIOx_* values). DIO0 is managed by the driver, it is switched
+	 between RxDone and TxDone (PayloadReady and PacketSent in FSK/OOK) as needed. The zero value is the chip
+	 default. Frequency hopping and the FSK/OOK FIFO level interrupts are not supported, so FSK/OOK packets are
+	 limited to the FIFO size, and those mappings have no constants.
+*/
+
+type RFM95W_DIOMapping struct {
+	DIO1              byte
+	DIO2              byte
+	DIO3              byte
+	DIO4              byte
+	DIO5              byte
+	MapPreambleDetect bool // FSK: DIO4 mapping 11 signals PreambleDetect instead of ModeReady.
+}
+
+// An interrupt from one of the DIO lines.
+type dioEvent struct {
+	Line int
+	Time time.Time
+}
+
+/*
+	dioPins().
+	 Returns the pin connected to each DIO line.
+*/
+
+func (r *RFM95W) dioPins() [6]int {
+	p := r.Pins
+	return [6]int{p.DIO0.number(), p.DIO1.number(), p.DIO2.number(), p.DIO3.number(), p.DIO4.number(), p.DIO5.number()}
+}
+
+/*
+	setupInterrupts().
+	 Sets up an interrupt source for each connected DIO line, feeding a single channel for queueHandler.
+*/
+
+func (r *RFM95W) setupInterrupts() error {
+	c := make(chan dioEvent, 16)
+	for line, pin := range r.dioPins() {
+		if pin == RF95W_PIN_NONE {
+			continue
+		}
+		ic, err := r.GPIO.Interrupt(pin)
+		if err != nil {
+			return err
+		}
+		go func(line int, ic <-chan GPIOEvent) {
+			for ev := range ic {
+				c <- dioEvent{Line: line, Time: ev.Time}
+			}
+		}(line, ic)
+	}
+	r.interruptChan = c
+	return nil
+}
+
+/*
+	setDIOMapping().
+	 Writes RegDioMapping1 with the given DIO0 mapping and the configured DIO1-DIO3 mappings.
+*/
+
+func (r *RFM95W) setDIOMapping(dio0 byte) error {
+	m := r.dioMapping
+	var val byte
+	val = RF95W_FIELD_DIO0MAPPING.Set(val, dio0)
+	val = RF95W_FIELD_DIO1MAPPING.Set(val, m.DIO1)
+	val = RF95W_FIELD_DIO2MAPPING.Set(val, m.DIO2)
+	val = RF95W_FIELD_DIO3MAPPING.Set(val, m.DIO3)
+	_, err := r.SetRegister(RF95W_REG_DIOMAPPING1, val)
+	return err
+}
+
+/*
+	setDIOMapping2().
+	 Writes RegDioMapping2 with the configured DIO4 and DIO5 mappings.
+*/
+
+func (r *RFM95W) setDIOMapping2() error {
+	m := r.dioMapping
+	var val byte
+	val = RF95W_FIELD_DIO4MAPPING.Set(val, m.DIO4)
+	val = RF95W_FIELD_DIO5MAPPING.Set(val, m.DIO5)
+	if m.MapPreambleDetect {
+		val = RF95W_FIELD_MAPPREAMBLEDETECT.Set(val, 1)
+	}
+	_, err := r.SetRegister(RF95W_REG_DIOMAPPING2, val)
+	return err
+}
+
+/*
+	getIRQFlags().
+	 Reads RegIrqFlags. FSK: RegIrqFlags1/2 are translated to the matching LoRa flags, PacketSent to TxDone,
+	 PayloadReady to RxDone (with PayloadCrcError if CrcOk is not set) and SyncAddressMatch to ValidHeader.
+*/
+
+func (r *RFM95W) getIRQFlags() (byte, error) {
+	if r.isLoRa() {
+		return r.GetRegister(RF95W_REG_IRQFLAGS)
+	}
+	b, err := r.GetBytes(RF95W_REG_FSK_IRQFLAGS1, 2)
+	if err != nil {
+		return 0, err
+	}
+	var flags byte
+	if b[1]&RF95W_FSK_IRQ2_PACKETSENT != 0 {
+		flags |= RF95W_IRQ_FLAG_TXDONE
+	}
+	if b[1]&RF95W_FSK_IRQ2_PAYLOADREADY != 0 {
+		flags |= RF95W_IRQ_FLAG_RXDONE
+		if r.settings.CRC && b[1]&RF95W_FSK_IRQ2_CRCOK == 0 {
+			flags |= RF95W_IRQ_FLAG_PAYLOADCRCERROR
+		}
+	}
+	if b[0]&RF95W_FSK_IRQ1_SYNCADDRESSMATCH != 0 {
+		flags |= RF95W_IRQ_FLAG_VALIDHEADER
+	}
+	return flags, nil
+}
+
+/*
+	clearIRQFlags().
+	 Clears IRQ flags in RegIrqFlags. FSK: nothing to do, PacketSent clears when leaving TX and PayloadReady when
+	 the FIFO has been read.
+*/
+
+func (r *RFM95W) clearIRQFlags(flags byte) error {
+	if !r.isLoRa() {
+		return nil
+	}
+	_, err := r.SetRegister(RF95W_REG_IRQFLAGS, flags)
+	return err
+}
+
+/*
+	rxInProgress().
+	 Checks RegModemStat to see if a packet is being received. FSK: the sync word was received, but not yet the
+	 whole packet.
+*/
+
+func (r *RFM95W) rxInProgress() bool {
+	if !r.isLoRa() {
+		flags, err := r.getIRQFlags()
+		return err == nil && flags&RF95W_IRQ_FLAG_VALIDHEADER != 0 && flags&RF95W_IRQ_FLAG_RXDONE == 0
+	}
+	ongoing, err := r.GetFlag(RF95W_FIELD_RXONGOING)
+	return err == nil && ongoing
+}
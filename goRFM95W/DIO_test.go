@@ -0,0 +1,88 @@
+package goRFM95W
+
+import (
+	"testing"
+	"time"
+)
+
+// validHeader raises ValidHeader on the emulator, as at the start of a LoRa reception.
+func validHeader(e *SX1276Emulator) {
+	e.SetRegister(RF95W_REG_MODEMSTAT, 0x04)
+	e.mu.Lock()
+	e.setIRQ(RF95W_IRQ_FLAG_VALIDHEADER)
+	e.mu.Unlock()
+}
+
+func TestDIOMapping(t *testing.T) {
+	e := NewSX1276Emulator()
+	pins := RF95W_EMULATOR_PINS
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins, SettleTime: time.Millisecond, DIOMapping: RFM95W_DIOMapping{DIO3: RF95W_DIO3_VALIDHEADER}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer r.Stop()
+	startReceiving(t, r, e)
+	if v := e.Register(RF95W_REG_DIOMAPPING1); v&0x03 != RF95W_DIO3_VALIDHEADER {
+		t.Fatalf("RegDioMapping1 %02x, expected ValidHeader on DIO3.", v)
+	}
+
+	// TX waits for a reception in progress to finish.
+	validHeader(e)
+	time.Sleep(10 * time.Millisecond)
+	if err := r.Send([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if tx := e.Transmitted(); len(tx) != 0 {
+		t.Fatalf("Transmitted %q during a reception.", tx)
+	}
+	if err := e.Receive(EmulatorPacket{Payload: []byte("in")}); err != nil {
+		t.Fatal(err)
+	}
+	waitReceived(t, r, 1)
+	waitTransmitted(t, e, 1)
+
+	// A header without a packet: TX goes ahead once the modem is no longer receiving.
+	waitFor(t, "RXCONTINUOUS after TX", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+	validHeader(e)
+	time.Sleep(10 * time.Millisecond)
+	if err := r.Send([]byte("y")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if tx := e.Transmitted(); len(tx) != 0 {
+		t.Fatalf("Transmitted %q during a reception.", tx)
+	}
+	e.SetRegister(RF95W_REG_MODEMSTAT, 0x00)
+	if tx := waitTransmitted(t, e, 1); string(tx[0]) != "y" {
+		t.Fatalf("Transmitted %q.", tx)
+	}
+}
+
+func TestCAD(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	startReceiving(t, r, e)
+	for _, busy := range []bool{false, true} {
+		e.Busy = busy
+		detected, err := r.ChannelActive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detected != busy {
+			t.Fatalf("ChannelActive() %t, want %t.", detected, busy)
+		}
+		// The handler goes back to receiving after the job.
+		waitFor(t, "RXCONTINUOUS after CAD", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+		if v := e.Register(RF95W_REG_IRQFLAGS); v != 0 {
+			t.Fatalf("RegIrqFlags %02x not cleared after CAD.", v)
+		}
+	}
+}
+
+func TestCADNotLoRa(t *testing.T) {
+	r, _ := newTestModule(t, &RFM95W_Params{TransmitMode: RF95W_TRANSMIT_FSK, Frequency: 915000000, DataRate: 9600})
+	if _, err := r.ChannelActive(); err == nil {
+		t.Fatal("ChannelActive() accepted in FSK mode.")
+	}
+}
@@ -0,0 +1,565 @@
+// FSK/OOK specific functions.
+
+package goRFM95W
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	RF95W_FSK_DEFAULT_BITRATE  = 4800 // bit/s
+	RF95W_FSK_DEFAULT_FDEV     = 5000 // Hz
+	RF95W_FSK_DEFAULT_PREAMBLE = 5    // Bytes.
+
+	RF95W_FSK_MIN_BITRATE = 1200   // bit/s
+	RF95W_FSK_MAX_BITRATE = 300000 // bit/s
+	RF95W_FSK_MIN_FDEV    = 600    // Hz
+	RF95W_FSK_MAX_FDEV    = 200000 // Hz
+	RF95W_FSK_MAX_SIGNAL  = 250000 // Hz. Limit of FrequencyDeviation + DataRate / 2.
+	RF95W_OOK_MAX_BITRATE = 32768  // bit/s
+
+	// Packets must fit in the FIFO, it is not refilled or emptied during TX and RX. In variable length packets
+	// the length byte takes one byte.
+	RF95W_FSK_FIFO_SIZE = 64
+
+	// RegIrqFlags1/2 flags.
+	RF95W_FSK_IRQ1_SYNCADDRESSMATCH = 0x01
+	RF95W_FSK_IRQ2_FIFOOVERRUN      = 0x10
+	RF95W_FSK_IRQ2_PACKETSENT       = 0x08
+	RF95W_FSK_IRQ2_PAYLOADREADY     = 0x04
+	RF95W_FSK_IRQ2_CRCOK            = 0x02
+
+	// Gaussian filter for RFM95W_Params.Shaping.
+	RF95W_SHAPING_NONE   = 0
+	RF95W_SHAPING_BT_1_0 = 1
+	RF95W_SHAPING_BT_0_5 = 2
+	RF95W_SHAPING_BT_0_3 = 3
+	// OOK: filter cutoff frequency.
+	RF95W_SHAPING_OOK_BR  = 1 // fcutoff = DataRate.
+	RF95W_SHAPING_OOK_2BR = 2 // fcutoff = 2 * DataRate.
+
+	// RFM95W_Params.OOKThreshold values, for the OOK data slicer.
+	RF95W_OOK_THRESHOLD_PEAK    = 0  // Follows the peak RSSI, decaying down to OOKFixedThreshold below it.
+	RF95W_OOK_THRESHOLD_FIXED   = 1  // OOKFixedThreshold.
+	RF95W_OOK_THRESHOLD_AVERAGE = 2  // Average of the RSSI.
+	RF95W_OOK_DEFAULT_FIXED     = 12 // dB
+
+	// RFM95W_Params.AddressFiltering values.
+	RF95W_ADDRESS_FILTER_OFF       = 0
+	RF95W_ADDRESS_FILTER_NODE      = 1 // Only packets to NodeAddress are received.
+	RF95W_ADDRESS_FILTER_BROADCAST = 2 // Packets to NodeAddress or BroadcastAddress are received.
+
+	RF95W_FSK_RXTRIGGER_PREAMBLE = 0x06 // RegRxConfig RxTrigger: start receiving on PreambleDetect.
+	RF95W_FSK_PREAMBLEDETECT     = 0xAA // RegPreambleDetect: on, 2 bytes, 10 chips tolerance.
+	RF95W_FSK_DCFREE_WHITENING   = 0x2  // RegPacketConfig1 DcFree.
+	RF95W_FSK_AUTORESTART_PLL    = 0x2  // RegSyncConfig AutoRestartRxMode: restart RX after a packet, wait for PLL lock.
+)
+
+// RegOokPeak OokThreshType values for RFM95W_Params.OOKThreshold.
+var ookThresholdTypes = map[int]byte{
+	RF95W_OOK_THRESHOLD_PEAK:    0x1,
+	RF95W_OOK_THRESHOLD_FIXED:   0x0,
+	RF95W_OOK_THRESHOLD_AVERAGE: 0x2,
+}
+
+// Used when RFM95W_Params.FSKSyncWord is empty.
+var RF95W_FSK_DEFAULT_SYNCWORD = []byte{0x2D, 0xD4}
+
+// RegRxBw values (RxBwMant, RxBwExp) for the receiver bandwidths (Hz) in FSK mode.
+var RFM95W_FSKBandwidths = map[int]byte{
+	2600:   0x17,
+	3100:   0x0F,
+	3900:   0x07,
+	5200:   0x16,
+	6300:   0x0E,
+	7800:   0x06,
+	10400:  0x15,
+	12500:  0x0D,
+	15600:  0x05,
+	20800:  0x14,
+	25000:  0x0C,
+	31300:  0x04,
+	41700:  0x13,
+	50000:  0x0B,
+	62500:  0x03,
+	83300:  0x12,
+	100000: 0x0A,
+	125000: 0x02,
+	166700: 0x11,
+	200000: 0x09,
+	250000: 0x01,
+}
+
+/*
+	fskDefaults().
+	 Returns the parameters with the FSK/OOK defaults filled in for zero values. The OOK receiver bandwidth is
+	 selected for DataRate only, transmitters with a large frequency error need a wider one.
+*/
+
+func fskDefaults(param RFM95W_Params) RFM95W_Params {
+	if param.DataRate == 0 {
+		param.DataRate = RF95W_FSK_DEFAULT_BITRATE
+	}
+	if param.TransmitMode == RF95W_TRANSMIT_OOK {
+		if param.Bandwidth == 0 {
+			param.Bandwidth = fskBandwidth(param.DataRate)
+		}
+		if param.OOKFixedThreshold == 0 {
+			param.OOKFixedThreshold = RF95W_OOK_DEFAULT_FIXED
+		}
+	} else {
+		if param.FrequencyDeviation == 0 {
+			param.FrequencyDeviation = RF95W_FSK_DEFAULT_FDEV
+		}
+		if param.Bandwidth == 0 {
+			param.Bandwidth = fskBandwidth(param.FrequencyDeviation + param.DataRate/2)
+		}
+	}
+	if param.PreambleLength == 0 {
+		param.PreambleLength = RF95W_FSK_DEFAULT_PREAMBLE
+	}
+	if len(param.FSKSyncWord) == 0 {
+		param.FSKSyncWord = RF95W_FSK_DEFAULT_SYNCWORD
+	}
+	return param
+}
+
+/*
+	fskBandwidth().
+	 Returns the narrowest receiver bandwidth that passes a signal extending bw (Hz) either side of the carrier.
+*/
+
+func fskBandwidth(bw int) int {
+	ret := 0
+	for b := range RFM95W_FSKBandwidths {
+		if b >= bw && (ret == 0 || b < ret) {
+			ret = b
+		}
+	}
+	return ret
+}
+
+/*
+	fskLimits().
+	 Maximum data rate and shaping setting for RF95W_MODE_FSK or RF95W_MODE_OOK.
+*/
+
+func fskLimits(mode int) (int, int) {
+	if mode == RF95W_MODE_OOK {
+		return RF95W_OOK_MAX_BITRATE, RF95W_SHAPING_OOK_2BR
+	}
+	return RF95W_FSK_MAX_BITRATE, RF95W_SHAPING_BT_0_3
+}
+
+/*
+	validateFSKParams().
+	 The FSK/OOK specific part of validateParams().
+*/
+
+func validateFSKParams(param RFM95W_Params) error {
+	param = fskDefaults(param)
+	modem := RFM95W_TransmitModes[param.TransmitMode]
+	maxRate, maxShaping := fskLimits(modem)
+	if param.DataRate < RF95W_FSK_MIN_BITRATE || param.DataRate > maxRate {
+		return errors.New("Invalid data rate requested.")
+	}
+	if modem == RF95W_MODE_FSK && (param.FrequencyDeviation < RF95W_FSK_MIN_FDEV ||
+		param.FrequencyDeviation > RF95W_FSK_MAX_FDEV || param.FrequencyDeviation+param.DataRate/2 > RF95W_FSK_MAX_SIGNAL) {
+		return errors.New("Invalid frequency deviation requested.")
+	}
+	if _, ok := RFM95W_FSKBandwidths[param.Bandwidth]; !ok {
+		return errors.New("Invalid bandwidth requested.")
+	}
+	if param.PreambleLength < 1 || param.PreambleLength > 65535 {
+		return errors.New("Invalid preamble length requested.")
+	}
+	if param.Shaping < RF95W_SHAPING_NONE || param.Shaping > maxShaping {
+		return errors.New("Invalid shaping requested.")
+	}
+	if !validFSKSyncWord(param.FSKSyncWord) {
+		return errors.New("Invalid sync word requested.")
+	}
+	if param.HeaderMode != RF95W_HEADER_EXPLICIT && param.HeaderMode != RF95W_HEADER_IMPLICIT {
+		return errors.New("Invalid header mode requested.")
+	}
+	if param.HeaderMode == RF95W_HEADER_IMPLICIT && (param.PayloadLength < 1 || param.PayloadLength > RF95W_FSK_FIFO_SIZE) {
+		return errors.New("Fixed length packets require a payload length (PayloadLength) of 1-64 bytes.")
+	}
+	if param.AddressFiltering < RF95W_ADDRESS_FILTER_OFF || param.AddressFiltering > RF95W_ADDRESS_FILTER_BROADCAST {
+		return errors.New("Invalid address filtering requested.")
+	}
+	if !validSetting(param.AGC) {
+		return errors.New("Invalid AGC setting requested.")
+	}
+	if _, ok := ookThresholdTypes[param.OOKThreshold]; !ok || param.OOKFixedThreshold < 0 || param.OOKFixedThreshold > 0xFF {
+		return errors.New("Invalid OOK threshold requested.")
+	}
+	return nil
+}
+
+func validFSKSyncWord(sync []byte) bool {
+	if len(sync) < 1 || len(sync) > 8 {
+		return false
+	}
+	for _, b := range sync {
+		if b == 0x00 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	setFSKParams().
+	 The FSK/OOK specific part of setParams().
+*/
+
+func (r *RFM95W) setFSKParams(param RFM95W_Params) {
+	param = fskDefaults(param)
+	r.SetDataRate(param.DataRate)
+	if r.mode == RF95W_MODE_OOK {
+		r.SetOOKThreshold(param.OOKThreshold, param.OOKFixedThreshold)
+	} else {
+		r.SetFrequencyDeviation(param.FrequencyDeviation)
+	}
+	r.SetBandwidth(param.Bandwidth)
+	r.SetShaping(param.Shaping)
+	r.SetPreambleLength(param.PreambleLength)
+	r.SetFSKSyncWord(param.FSKSyncWord)
+	r.setFSKPacketConfig(param)
+	r.setFSKRXConfig()
+}
+
+/*
+	SetDataRate().
+	 FSK/OOK. Sets the bit rate (bit/s), from 1200-300000 (FSK) or 1200-32768 (OOK).
+	 FSK: BitRate = FXOSC / (RegBitrate + RegBitrateFrac / 16). OOK: BitRate = FXOSC / RegBitrate.
+*/
+
+func (r *RFM95W) SetDataRate(br int) error {
+	if r.isLoRa() {
+		return errors.New("SetDataRate(): not in FSK/OOK mode.")
+	}
+	maxRate, _ := fskLimits(r.mode)
+	if br < RF95W_FSK_MIN_BITRATE || br > maxRate {
+		return errors.New("Invalid data rate requested.")
+	}
+	val := uint32(math.Floor(16*RF95W_FXOSC/float64(br) + 0.5))
+	if r.mode == RF95W_MODE_OOK {
+		// No fractional part.
+		val = uint32(math.Floor(RF95W_FXOSC/float64(br)+0.5)) << 4
+	}
+	r.SetRegister(RF95W_REG_BITRATEMSB, byte(val>>12))
+	r.SetRegister(RF95W_REG_BITRATELSB, byte(val>>4))
+	_, err := r.SetRegister(RF95W_REG_BITRATEFRAC, byte(val&0x0F))
+	if err == nil {
+		r.settings.DataRate = br
+	}
+	return err
+}
+
+/*
+	SetFrequencyDeviation().
+	 FSK. Sets the frequency deviation (Hz), from 600-200000. Fdev = RegFdev * FXOSC / 2^19.
+*/
+
+func (r *RFM95W) SetFrequencyDeviation(fdev int) error {
+	if r.mode != RF95W_MODE_FSK {
+		return errors.New("SetFrequencyDeviation(): not in FSK mode.")
+	}
+	if fdev < RF95W_FSK_MIN_FDEV || fdev > RF95W_FSK_MAX_FDEV {
+		return errors.New("Invalid frequency deviation requested.")
+	}
+	steps := uint32(((uint64(fdev) << 19) + RF95W_FXOSC/2) / RF95W_FXOSC)
+	r.SetRegister(RF95W_REG_FDEVMSB, byte(steps>>8)&0x3F)
+	_, err := r.SetRegister(RF95W_REG_FDEVLSB, byte(steps&0xFF))
+	if err == nil {
+		r.settings.FrequencyDeviation = fdev
+	}
+	return err
+}
+
+/*
+	setFSKBandwidth().
+	 Sets the receiver bandwidth (Hz), one of RFM95W_FSKBandwidths.
+*/
+
+func (r *RFM95W) setFSKBandwidth(bw int) error {
+	b, ok := RFM95W_FSKBandwidths[bw]
+	if !ok {
+		return errors.New("Invalid bandwidth requested.")
+	}
+	_, err := r.SetRegister(RF95W_REG_FSK_RXBW, b)
+	if err == nil {
+		r.settings.Bandwidth = bw
+	}
+	return err
+}
+
+/*
+	SetShaping().
+	 FSK/OOK. Sets the data shaping of the transmitter: the Gaussian filter (RF95W_SHAPING_*) in FSK mode, or the
+	 filter cutoff (RF95W_SHAPING_OOK_*) in OOK mode.
+*/
+
+func (r *RFM95W) SetShaping(shaping int) error {
+	if r.isLoRa() {
+		return errors.New("SetShaping(): not in FSK/OOK mode.")
+	}
+	_, maxShaping := fskLimits(r.mode)
+	if shaping < RF95W_SHAPING_NONE || shaping > maxShaping {
+		return errors.New("Invalid shaping requested.")
+	}
+	err := r.SetField(RF95W_FIELD_MODULATIONSHAPING, byte(shaping))
+	if err == nil {
+		r.settings.Shaping = shaping
+	}
+	return err
+}
+
+/*
+	SetOOKThreshold().
+	 OOK. Sets the data slicer threshold mode, RF95W_OOK_THRESHOLD_*, and the fixed threshold (dB), which is also the
+	 floor of the threshold in peak mode. The peak threshold decays in 0.5 dB steps once per chip.
+*/
+
+func (r *RFM95W) SetOOKThreshold(threshold, fixed int) error {
+	if r.mode != RF95W_MODE_OOK {
+		return errors.New("SetOOKThreshold(): not in OOK mode.")
+	}
+	t, ok := ookThresholdTypes[threshold]
+	if !ok || fixed < 0 || fixed > 0xFF {
+		return errors.New("Invalid OOK threshold requested.")
+	}
+	// The bit synchronizer can't be turned off in packet mode.
+	var val byte
+	val = RF95W_FIELD_BITSYNCON.Set(val, 1)
+	val = RF95W_FIELD_OOKTHRESHTYPE.Set(val, t)
+	_, err := r.SetRegister(RF95W_REG_FSK_OOKPEAK, val)
+	if err != nil {
+		return err
+	}
+	_, err = r.SetRegister(RF95W_REG_FSK_OOKFIX, byte(fixed))
+	if err == nil {
+		r.settings.OOKThreshold = threshold
+		r.settings.OOKFixedThreshold = fixed
+	}
+	return err
+}
+
+/*
+	SetFSKSyncWord().
+	 FSK/OOK. Sets the sync word, 1-8 bytes. 0x00 bytes are not allowed. Only packets with the same sync word are
+	 received.
+*/
+
+func (r *RFM95W) SetFSKSyncWord(sync []byte) error {
+	if r.isLoRa() {
+		return errors.New("SetFSKSyncWord(): not in FSK/OOK mode, see SetSyncWord().")
+	}
+	if !validFSKSyncWord(sync) {
+		return errors.New("Invalid sync word requested.")
+	}
+	var val byte
+	val = RF95W_FIELD_AUTORESTARTRXMODE.Set(val, RF95W_FSK_AUTORESTART_PLL)
+	val = RF95W_FIELD_SYNCON.Set(val, 1)
+	val = RF95W_FIELD_SYNCSIZE.Set(val, byte(len(sync)-1))
+	_, err := r.SetRegister(RF95W_REG_FSK_SYNCCONFIG, val)
+	if err != nil {
+		return err
+	}
+	_, err = r.SetBytes(RF95W_REG_FSK_SYNCVALUE1, sync)
+	if err == nil {
+		r.settings.FSKSyncWord = append([]byte(nil), sync...)
+	}
+	return err
+}
+
+/*
+	setFSKPacketConfig().
+	 Sets up packet mode: fixed (RF95W_HEADER_IMPLICIT) or variable length packets, CRC, whitening and address
+	 filtering. TX starts as soon as the packet is in the FIFO.
+*/
+
+func (r *RFM95W) setFSKPacketConfig(param RFM95W_Params) error {
+	var val byte
+	if param.HeaderMode != RF95W_HEADER_IMPLICIT {
+		val = RF95W_FIELD_PACKETFORMAT.Set(val, 1)
+	}
+	if param.Whitening {
+		val = RF95W_FIELD_DCFREE.Set(val, RF95W_FSK_DCFREE_WHITENING)
+	}
+	if param.CRC {
+		val = RF95W_FIELD_CRCON.Set(val, 1)
+	}
+	val = RF95W_FIELD_ADDRESSFILTERING.Set(val, byte(param.AddressFiltering))
+	_, err := r.SetRegister(RF95W_REG_FSK_PACKETCONFIG1, val)
+	if err != nil {
+		return err
+	}
+	_, err = r.SetRegister(RF95W_REG_FSK_PACKETCONFIG2, RF95W_FIELD_DATAMODE.Set(0, 1))
+	if err != nil {
+		return err
+	}
+	// Fixed length, or the maximum length accepted in variable length packets.
+	payloadLength := RF95W_FSK_FIFO_SIZE - 1
+	if param.HeaderMode == RF95W_HEADER_IMPLICIT {
+		payloadLength = param.PayloadLength
+	}
+	r.SetRegister(RF95W_REG_FSK_PAYLOADLENGTH, byte(payloadLength))
+	r.SetRegister(RF95W_REG_FSK_NODEADRS, param.NodeAddress)
+	r.SetRegister(RF95W_REG_FSK_BROADCASTADRS, param.BroadcastAddress)
+	err = r.SetFlag(RF95W_FIELD_TXSTARTCONDITION, true)
+	if err != nil {
+		return err
+	}
+	r.settings.HeaderMode = param.HeaderMode
+	r.settings.PayloadLength = param.PayloadLength
+	r.settings.CRC = param.CRC
+	r.settings.Whitening = param.Whitening
+	r.settings.AddressFiltering = param.AddressFiltering
+	r.settings.NodeAddress = param.NodeAddress
+	r.settings.BroadcastAddress = param.BroadcastAddress
+	return nil
+}
+
+/*
+	setFSKRXConfig().
+	 The receiver starts on a detected preamble, with the LNA gain set by the AGC unless AGC is RF95W_SETTING_OFF.
+*/
+
+func (r *RFM95W) setFSKRXConfig() error {
+	val := byte(RF95W_FSK_RXTRIGGER_PREAMBLE)
+	if r.settings.AGC != RF95W_SETTING_OFF {
+		val |= 0x08 // AgcAutoOn.
+	}
+	_, err := r.SetRegister(RF95W_REG_FSK_RXCONFIG, val)
+	if err != nil {
+		return err
+	}
+	_, err = r.SetRegister(RF95W_REG_FSK_PREAMBLEDETECT, RF95W_FSK_PREAMBLEDETECT)
+	return err
+}
+
+/*
+	fixedLength().
+	 True if packets have a fixed length of PayloadLength, without a length byte.
+*/
+
+func (r *RFM95W) fixedLength() bool {
+	return r.settings.HeaderMode == RF95W_HEADER_IMPLICIT
+}
+
+/*
+	checkFSKMessage().
+	 Checks that the message fits in a packet with the current settings. FIFO refills and drains on FifoLevel are
+	 not implemented, so a whole packet has to fit in the 64 byte FIFO: at most 63 bytes after the length byte for
+	 variable length packets. RegPayloadLength makes the receiver drop longer ones.
+*/
+
+func (r *RFM95W) checkFSKMessage(msg []byte) error {
+	if r.fixedLength() {
+		if len(msg) != r.settings.PayloadLength {
+			return errors.New("Message length must be PayloadLength for fixed length packets.")
+		}
+		return nil
+	}
+	if len(msg) > RF95W_FSK_FIFO_SIZE-1 {
+		return errors.New("Message too long.")
+	}
+	if len(msg) == 0 && r.settings.AddressFiltering != RF95W_ADDRESS_FILTER_OFF {
+		return errors.New("Message must start with the address byte.")
+	}
+	return nil
+}
+
+/*
+	writeFSKPacket().
+	 Writes the packet into the FIFO, with the length byte for variable length packets, and maps DIO0 to
+	 PacketSent. The caller switches to TX.
+*/
+
+func (r *RFM95W) writeFSKPacket(msg []byte) error {
+	buf := msg
+	if !r.fixedLength() {
+		buf = append([]byte{byte(len(msg))}, msg...)
+	}
+	_, err := r.SetBytes(RF95W_REG_FIFO, buf)
+	if err != nil {
+		return err
+	}
+	return r.setDIOMapping(RF95W_FSK_DIO0_PACKETSENT)
+}
+
+/*
+	setFSKRXMode().
+	 Switches to RXCONTINUOUS with DIO0 interrupting on PayloadReady. With DeliverCRCErrors, packets that failed the
+	 CRC check are kept in the FIFO (CrcAutoClearOff) so that they can be read.
+*/
+
+func (r *RFM95W) setFSKRXMode() error {
+	err := r.SetFlag(RF95W_FIELD_CRCAUTOCLEAROFF, r.DeliverCRCErrors)
+	if err != nil {
+		return err
+	}
+
+	err = r.SetMode(RF95W_MODE_RXCONTINUOUS)
+	if err != nil {
+		return err
+	}
+
+	return r.setDIOMapping(RF95W_FSK_DIO0_PAYLOADREADY)
+}
+
+/*
+	readFSKPacket().
+	 Reads the received packet out of the FIFO and appends it to RecvBuf. Emptying the FIFO clears PayloadReady
+	 and restarts the receiver. The packet RSSI is the one sampled on SyncAddressMatch, seen when polling or with
+	 DIO2 mapped to RF95W_FSK_DIO2_SYNCADDRESS. Otherwise RegRssiValue is read when the packet is complete.
+*/
+
+func (r *RFM95W) readFSKPacket(received time.Time, crcValid bool) error {
+	msgLen := r.settings.PayloadLength
+	if !r.fixedLength() {
+		l, err := r.GetRegister(RF95W_REG_FIFO)
+		if err != nil {
+			return fmt.Errorf("can't get length: %s", err.Error())
+		}
+		msgLen = int(l)
+	}
+	msgBuf, err := r.GetBytes(RF95W_REG_FIFO, msgLen)
+	if err != nil {
+		return fmt.Errorf("can't read FIFO buffer: %s", err.Error())
+	}
+	rssi := r.syncRSSI
+	if !r.syncRSSIValid {
+		rssi, _ = r.currentRSSI()
+	}
+	r.syncRSSIValid = false
+	var newMessage RFM95W_Message
+	newMessage.RSSI = rssi
+	newMessage.SignalRSSI = float64(rssi)
+	newMessage.Buf = msgBuf
+	newMessage.Received = received
+	newMessage.Params = r.settings
+	newMessage.CRCPresent = r.settings.CRC
+	newMessage.CRCValid = crcValid
+	r.mu_Recv.Lock()
+	r.RecvBuf = append(r.RecvBuf, newMessage)
+	r.mu_Recv.Unlock()
+	return nil
+}
+
+/*
+	clearFSKFIFO().
+	 Drops a packet left in the FIFO, e.g. one that failed the CRC check while CrcAutoClearOff is set. Setting
+	 FifoOverrun clears the FIFO and PayloadReady, so that the receiver restarts.
+*/
+
+func (r *RFM95W) clearFSKFIFO() error {
+	_, err := r.SetRegister(RF95W_REG_FSK_IRQFLAGS2, RF95W_FSK_IRQ2_FIFOOVERRUN)
+	return err
+}
@@ -0,0 +1,224 @@
+package goRFM95W
+
+import (
+	"bytes"
+	"testing"
+)
+
+// waitFSKReceiving waits for FSK/OOK RXCONTINUOUS.
+func waitFSKReceiving(t *testing.T, e *SX1276Emulator) {
+	t.Helper()
+	waitFor(t, "FSK RXCONTINUOUS", func() bool {
+		return e.Mode()&RF95W_MODE_LORA == 0 && e.Mode()&0x07 == RF95W_MODE_RXCONTINUOUS
+	})
+}
+
+func TestFSKConfig(t *testing.T) {
+	p := RFM95W_Params{TransmitMode: RF95W_TRANSMIT_FSK, Frequency: 915000000, DataRate: 9600, CRC: true, Whitening: true, FSKSyncWord: []byte{1, 2, 3}, AddressFiltering: RF95W_ADDRESS_FILTER_BROADCAST, NodeAddress: 5, BroadcastAddress: 0xFF}
+	r, e := newTestModule(t, &p)
+	// Defaults derived from the data rate.
+	if r.settings.Bandwidth != 10400 || r.settings.PreambleLength != 5 {
+		t.Fatalf("Settings %+v.", r.settings)
+	}
+	if e.Mode()&RF95W_MODE_LORA != 0 {
+		t.Fatalf("RegOpMode %02x, expected FSK.", e.Mode())
+	}
+	// 32 MHz / 9600 = 3333.33: 0x0D05 and 5/16.
+	if e.Register(RF95W_REG_BITRATEMSB) != 0x0D || e.Register(RF95W_REG_BITRATELSB) != 0x05 || e.Register(RF95W_REG_BITRATEFRAC) != 0x05 {
+		t.Fatalf("RegBitrate %02x%02x, RegBitRateFrac %02x.", e.Register(RF95W_REG_BITRATEMSB), e.Register(RF95W_REG_BITRATELSB), e.Register(RF95W_REG_BITRATEFRAC))
+	}
+	if e.Register(RF95W_REG_FSK_SYNCCONFIG) != 0x92 || e.Register(RF95W_REG_FSK_SYNCVALUE1) != 1 {
+		t.Fatalf("RegSyncConfig %02x, RegSyncValue1 %02x.", e.Register(RF95W_REG_FSK_SYNCCONFIG), e.Register(RF95W_REG_FSK_SYNCVALUE1))
+	}
+	// Variable length, whitening, CRC on, node or broadcast address.
+	if v := e.Register(RF95W_REG_FSK_PACKETCONFIG1); v != 0xD4 {
+		t.Fatalf("RegPacketConfig1 %02x, expected d4.", v)
+	}
+	if v := e.Register(RF95W_REG_PARAMP) & 0x60; v != 0 {
+		t.Fatalf("RegPaRamp %02x, expected no shaping.", v)
+	}
+
+	bad := p
+	bad.FrequencyDeviation = 200000
+	bad.DataRate = 200000
+	if err := r.SetParams(bad); err == nil {
+		t.Fatal("Frequency deviation over the limit accepted.")
+	}
+	bad = p
+	bad.FSKSyncWord = []byte{0, 1}
+	if err := r.SetParams(bad); err == nil {
+		t.Fatal("Sync word with a zero byte accepted.")
+	}
+	// RegOpMode modem bits are not transmit modes.
+	for _, mode := range []RFM95W_TransmitMode{0x40, RF95W_MODE_LORA, RF95W_MODE_OOK} {
+		bad = p
+		bad.TransmitMode = mode
+		if err := r.SetParams(bad); err == nil {
+			t.Fatalf("Invalid TransmitMode %#x accepted.", mode)
+		}
+	}
+}
+
+func TestFSKSendReceive(t *testing.T) {
+	p := RFM95W_Params{TransmitMode: RF95W_TRANSMIT_FSK, Frequency: 915000000, DataRate: 9600, CRC: true, AddressFiltering: RF95W_ADDRESS_FILTER_BROADCAST, NodeAddress: 5, BroadcastAddress: 0xFF}
+	r, e := newTestModule(t, &p)
+	r.Start()
+	waitFSKReceiving(t, e)
+
+	if err := r.Send([]byte{5, 'h', 'i'}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Send([]byte{0xFF, 'x'}); err != nil {
+		t.Fatal(err)
+	}
+	tx := waitTransmitted(t, e, 2)
+	if len(tx) != 2 || !bytes.Equal(tx[0], []byte{5, 'h', 'i'}) || !bytes.Equal(tx[1], []byte{0xFF, 'x'}) {
+		t.Fatalf("Transmitted %q.", tx)
+	}
+	// The FIFO is 64 bytes, including the length byte.
+	if err := r.Send(make([]byte, 64)); err == nil {
+		t.Fatal("64 byte message accepted.")
+	}
+
+	waitFSKReceiving(t, e)
+	if err := e.Receive(EmulatorPacket{Payload: []byte{5, 'a'}, RSSI: -80}); err != nil {
+		t.Fatal(err)
+	}
+	msgs := waitReceived(t, r, 1)
+	// Packets for another node and with a CRC error are filtered out by the module.
+	for _, pkt := range []EmulatorPacket{{Payload: []byte{6, 'b'}}, {Payload: []byte{5, 'd'}, CRCError: true}, {Payload: []byte{0xFF, 'c'}, RSSI: -90}} {
+		if err := e.Receive(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs = append(msgs, waitReceived(t, r, 1)...)
+	if len(msgs) != 2 || string(msgs[0].Buf) != "\x05a" || msgs[0].RSSI != -80 || !msgs[0].CRCValid || string(msgs[1].Buf) != "\xffc" || msgs[1].RSSI != -90 {
+		t.Fatalf("Received %+v.", msgs)
+	}
+
+	// Reading the temperature returns to FSK RX.
+	if _, err := r.ReadTemperature(); err != nil {
+		t.Fatal(err)
+	}
+	waitFSKReceiving(t, e)
+}
+
+func TestFSKCRCErrorDiscarded(t *testing.T) {
+	p := RFM95W_Params{TransmitMode: RF95W_TRANSMIT_FSK, Frequency: 915000000, DataRate: 9600, CRC: true}
+	r, e := newTestModule(t, &p)
+	r.Start()
+	waitFSKReceiving(t, e)
+	// CrcAutoClearOff left over from DeliverCRCErrors: the bad packet stays in the FIFO until it is dropped.
+	e.SetRegister(RF95W_REG_FSK_PACKETCONFIG1, e.Register(RF95W_REG_FSK_PACKETCONFIG1)|0x08)
+
+	if err := e.Receive(EmulatorPacket{Payload: []byte("bad"), CRCError: true}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "FIFO cleared", func() bool { return e.Register(RF95W_REG_FSK_IRQFLAGS2)&RF95W_FSK_IRQ2_PAYLOADREADY == 0 })
+	if err := e.Receive(EmulatorPacket{Payload: []byte("good")}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := waitReceived(t, r, 1); string(msgs[0].Buf) != "good" || !msgs[0].CRCValid {
+		t.Fatalf("Received %+v.", msgs)
+	}
+}
+
+func TestFSKFixedLength(t *testing.T) {
+	p := RFM95W_Params{TransmitMode: RF95W_TRANSMIT_FSK, Frequency: 915000000, DataRate: 9600, CRC: true, HeaderMode: RF95W_HEADER_IMPLICIT, PayloadLength: 3}
+	r, e := newTestModule(t, &p)
+	r.DeliverCRCErrors = true
+	r.Start()
+	waitFSKReceiving(t, e)
+
+	if err := e.Receive(EmulatorPacket{Payload: []byte("abc"), CRCError: true}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := waitReceived(t, r, 1); string(msgs[0].Buf) != "abc" || msgs[0].CRCValid {
+		t.Fatalf("Received %+v.", msgs)
+	}
+	if err := r.Send([]byte("ab")); err == nil {
+		t.Fatal("Message not matching the payload length accepted.")
+	}
+	if err := r.Send([]byte("xyz")); err != nil {
+		t.Fatal(err)
+	}
+	if tx := waitTransmitted(t, e, 1); string(tx[0]) != "xyz" {
+		t.Fatalf("Transmitted %q.", tx)
+	}
+}
+
+func TestTransmitModeSwitch(t *testing.T) {
+	p := RFM95W_Params{TransmitMode: RF95W_TRANSMIT_FSK, Frequency: 915000000, DataRate: 9600}
+	r, e := newTestModule(t, &p)
+	if e.Mode()&RF95W_MODE_LORA != 0 {
+		t.Fatalf("RegOpMode %02x, expected FSK.", e.Mode())
+	}
+	// The zero TransmitMode is LoRa.
+	lp := RFM95W_Params{Frequency: 915000000, Bandwidth: 125000, SpreadingFactor: 7, CodingRate: 5, PreambleLength: 8}
+	if err := r.SetParams(lp); err != nil {
+		t.Fatal(err)
+	}
+	if e.Mode()&RF95W_MODE_LORA == 0 {
+		t.Fatalf("RegOpMode %02x, expected LoRa.", e.Mode())
+	}
+	if v := e.Register(RF95W_REG_MODEMCONFIG1); v>>4 != 0x7 {
+		t.Fatalf("RegModemConfig1 %02x, expected 125 kHz.", v)
+	}
+	// And back through FSK to an explicit RF95W_TRANSMIT_LORA.
+	if err := r.SetParams(p); err != nil || e.Mode()&RF95W_MODE_LORA != 0 {
+		t.Fatalf("RegOpMode %02x, expected FSK: %v", e.Mode(), err)
+	}
+	lp.TransmitMode = RF95W_TRANSMIT_LORA
+	if err := r.SetParams(lp); err != nil || e.Mode()&RF95W_MODE_LORA == 0 {
+		t.Fatalf("RegOpMode %02x, expected LoRa: %v", e.Mode(), err)
+	}
+}
+
+func TestOOK(t *testing.T) {
+	p := RFM95W_Params{TransmitMode: RF95W_TRANSMIT_OOK, Frequency: 868000000, DataRate: 4800, CRC: true, Shaping: RF95W_SHAPING_OOK_BR, OOKThreshold: RF95W_OOK_THRESHOLD_AVERAGE}
+	r, e := newTestModule(t, &p)
+	// 32 MHz / 4800 = 6666.67: 0x1A0B, no fractional part in OOK.
+	if e.Register(RF95W_REG_BITRATEMSB) != 0x1A || e.Register(RF95W_REG_BITRATELSB) != 0x0B || e.Register(RF95W_REG_BITRATEFRAC)&0x0F != 0 {
+		t.Fatalf("RegBitrate %02x%02x, RegBitRateFrac %02x.", e.Register(RF95W_REG_BITRATEMSB), e.Register(RF95W_REG_BITRATELSB), e.Register(RF95W_REG_BITRATEFRAC))
+	}
+	if v := e.Mode() & 0x60; v != 0x20 {
+		t.Fatalf("RegOpMode %02x, expected OOK.", e.Mode())
+	}
+	if e.Register(RF95W_REG_FSK_OOKPEAK) != 0x30 || e.Register(RF95W_REG_FSK_OOKFIX) != 12 {
+		t.Fatalf("RegOokPeak %02x, RegOokFix %d.", e.Register(RF95W_REG_FSK_OOKPEAK), e.Register(RF95W_REG_FSK_OOKFIX))
+	}
+	if v := e.Register(RF95W_REG_PARAMP) & 0x60; v != 0x20 {
+		t.Fatalf("RegPaRamp %02x, expected fcutoff = DataRate.", e.Register(RF95W_REG_PARAMP))
+	}
+	if r.settings.Bandwidth != 5200 {
+		t.Fatalf("Bandwidth %d, expected 5200.", r.settings.Bandwidth)
+	}
+
+	if err := r.SetFrequencyDeviation(5000); err == nil {
+		t.Fatal("Frequency deviation accepted in OOK.")
+	}
+	if err := r.SetShaping(RF95W_SHAPING_BT_0_3); err == nil {
+		t.Fatal("Gaussian shaping accepted in OOK.")
+	}
+	bad := p
+	bad.DataRate = 40000
+	if err := r.SetParams(bad); err == nil {
+		t.Fatal("40 kb/s accepted in OOK.")
+	}
+
+	r.Start()
+	waitFSKReceiving(t, e)
+	if err := r.Send([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if tx := waitTransmitted(t, e, 1); string(tx[0]) != "hi" {
+		t.Fatalf("Transmitted %q.", tx)
+	}
+	waitFSKReceiving(t, e)
+	if err := e.Receive(EmulatorPacket{Payload: []byte("ok"), RSSI: -70}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := waitReceived(t, r, 1); string(msgs[0].Buf) != "ok" || msgs[0].RSSI != -70 {
+		t.Fatalf("Received %+v.", msgs)
+	}
+}
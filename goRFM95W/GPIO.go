@@ -0,0 +1,313 @@
+// GPIO specific functions.
+
+package goRFM95W
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cyoung/rpi"
+	"sync"
+	"time"
+)
+
+const (
+	// Default hardware config (WiringPi numbering).
+	RF95W_CS_PIN       = rpi.PIN_CE0
+	RF95W_DIO0_INT_PIN = rpi.PIN_GPIO_6
+	RF95W_ACT_PIN      = rpi.PIN_CE1
+
+	RF95W_PIN_NONE = -1 // Line is not connected.
+
+	// Manual reset timing (datasheet 7.2.2).
+	RF95W_RESET_PULSE = 1 * time.Millisecond // NRESET low, >100 us.
+	RF95W_RESET_WAIT  = 5 * time.Millisecond // After releasing NRESET, before using the module.
+)
+
+/*
+	GPIO.
+	 Digital I/O used for chip select, the DIO interrupts, the ACT LED and the reset line.
+	 Interrupt() returns a channel that receives an event on every rising edge of the pin.
+	 Pins are claimed per GPIO value, so implementations must be comparable (e.g. pointer types) and instances
+	 that share the same hardware should be the same value.
+*/
+
+type GPIO interface {
+	SetOutput(pin int) error
+	SetInput(pin int) error
+	Write(pin int, high bool) error
+	Interrupt(pin int) (<-chan GPIOEvent, error)
+}
+
+/*
+	GPIOEvent.
+	 A rising edge on an interrupt pin. Time is the kernel timestamp of the edge where the backend provides one,
+	 otherwise the time the edge was seen.
+*/
+
+type GPIOEvent struct {
+	Pin  int
+	Time time.Time
+}
+
+/*
+	RFM95W_OptionalPin.
+	 A line that does not have to be wired. The zero value is not connected, OptionalPin() selects a pin.
+*/
+
+type RFM95W_OptionalPin struct {
+	pin       int
+	connected bool
+}
+
+/*
+	OptionalPin().
+	 Returns an RFM95W_OptionalPin connected to the given pin.
+*/
+
+func OptionalPin(pin int) RFM95W_OptionalPin {
+	return RFM95W_OptionalPin{pin: pin, connected: pin != RF95W_PIN_NONE}
+}
+
+/*
+	Get().
+	 Returns the pin and whether it is connected.
+*/
+
+func (p RFM95W_OptionalPin) Get() (int, bool) {
+	return p.pin, p.connected
+}
+
+/*
+	number().
+	 The pin, or RF95W_PIN_NONE if it is not connected.
+*/
+
+func (p RFM95W_OptionalPin) number() int {
+	if !p.connected {
+		return RF95W_PIN_NONE
+	}
+	return p.pin
+}
+
+/*
+	RFM95W_Pins.
+	 Per-instance pin map, in the numbering used by the GPIO implementation.
+	 Every line is optional: 0 is a valid pin number, so an unset field (the zero RFM95W_OptionalPin) means that
+	 the line is not wired. Use OptionalPin() to connect one.
+	 Without CS the SPI controller drives its hardware chip-select. Without DIO0, RegIrqFlags is polled.
+	 DIO1-DIO5 are extra interrupt sources, see RFM95W_DIOMapping for what they signal.
+*/
+
+type RFM95W_Pins struct {
+	CS    RFM95W_OptionalPin // Chip select.
+	DIO0  RFM95W_OptionalPin // DIO0 interrupt.
+	DIO1  RFM95W_OptionalPin
+	DIO2  RFM95W_OptionalPin
+	DIO3  RFM95W_OptionalPin
+	DIO4  RFM95W_OptionalPin
+	DIO5  RFM95W_OptionalPin
+	ACT   RFM95W_OptionalPin // ACT LED.
+	RESET RFM95W_OptionalPin // Module NRESET.
+}
+
+// Default wiring (RPi interface board).
+var RF95W_DEFAULT_PINS = RFM95W_Pins{
+	CS:   OptionalPin(RF95W_CS_PIN),
+	DIO0: OptionalPin(RF95W_DIO0_INT_PIN),
+	ACT:  OptionalPin(RF95W_ACT_PIN),
+}
+
+var (
+	wiringPiOnce sync.Once
+	wiringPi     *WiringPiGPIO
+
+	// Pins in use by all RFM95W instances in this process.
+	mu_Pins     = &sync.Mutex{}
+	claimedPins = make(map[pinClaim]*RFM95W)
+)
+
+type pinClaim struct {
+	gpio GPIO
+	pin  int
+}
+
+/*
+	WiringPiGPIO.
+	 GPIO implementation using the WiringPi library. Pins use WiringPi numbering.
+*/
+
+type WiringPiGPIO struct{}
+
+/*
+	NewWiringPiGPIO().
+	 Returns the WiringPi GPIO backend. The library is initialized once per process and the same backend is
+	 shared by all RFM95W instances.
+*/
+
+func NewWiringPiGPIO() *WiringPiGPIO {
+	wiringPiOnce.Do(func() {
+		rpi.WiringPiSetup()
+		wiringPi = &WiringPiGPIO{}
+	})
+	return wiringPi
+}
+
+func (g *WiringPiGPIO) SetOutput(pin int) error {
+	rpi.PinMode(pin, rpi.OUTPUT)
+	return nil
+}
+
+func (g *WiringPiGPIO) SetInput(pin int) error {
+	rpi.PinMode(pin, rpi.INPUT)
+	return nil
+}
+
+func (g *WiringPiGPIO) Write(pin int, high bool) error {
+	if high {
+		rpi.DigitalWrite(pin, rpi.HIGH)
+	} else {
+		rpi.DigitalWrite(pin, rpi.LOW)
+	}
+	return nil
+}
+
+func (g *WiringPiGPIO) Interrupt(pin int) (<-chan GPIOEvent, error) {
+	isr := rpi.WiringPiISR(pin, rpi.INT_EDGE_RISING)
+	ret := make(chan GPIOEvent, 16)
+	go func() {
+		for range isr {
+			ret <- GPIOEvent{Pin: pin, Time: time.Now()}
+		}
+	}()
+	return ret, nil
+}
+
+/*
+	claimPins().
+	 Reserves the CS, DIO, ACT and RESET pins for this instance. Fails if another RFM95W in the process is already
+	 using one of them on the same GPIO backend.
+*/
+
+func (r *RFM95W) claimPins() error {
+	dio := r.dioPins()
+	pins := append([]int{r.Pins.CS.number(), r.Pins.ACT.number(), r.Pins.RESET.number()}, dio[:]...)
+
+	mu_Pins.Lock()
+	defer mu_Pins.Unlock()
+
+	for i, pin := range pins {
+		if pin == RF95W_PIN_NONE {
+			continue
+		}
+		for _, other := range pins[:i] {
+			if other == pin {
+				return fmt.Errorf("Pin %d is assigned to more than one function.", pin)
+			}
+		}
+		if owner, ok := claimedPins[pinClaim{r.GPIO, pin}]; ok && owner != r {
+			return fmt.Errorf("Pin %d is already in use by another module.", pin)
+		}
+	}
+	for _, pin := range pins {
+		if pin != RF95W_PIN_NONE {
+			claimedPins[pinClaim{r.GPIO, pin}] = r
+		}
+	}
+	return nil
+}
+
+/*
+	releasePins().
+	 Releases the pins claimed by claimPins().
+*/
+
+func (r *RFM95W) releasePins() {
+	mu_Pins.Lock()
+	defer mu_Pins.Unlock()
+
+	for k, owner := range claimedPins {
+		if owner == r {
+			delete(claimedPins, k)
+		}
+	}
+}
+
+/*
+	setupPins().
+	 Configures the pin directions and idle levels.
+*/
+
+func (r *RFM95W) setupPins() error {
+	if cs, ok := r.Pins.CS.Get(); ok {
+		if err := r.GPIO.SetOutput(cs); err != nil { // Chip Select.
+			return err
+		}
+		r.GPIO.Write(cs, true)
+	}
+	for _, pin := range r.dioPins() {
+		if pin == RF95W_PIN_NONE {
+			continue
+		}
+		if err := r.GPIO.SetInput(pin); err != nil { // DIO interrupt.
+			return err
+		}
+	}
+	if act, ok := r.Pins.ACT.Get(); ok {
+		if err := r.GPIO.SetOutput(act); err != nil { // ACT LED.
+			return err
+		}
+		r.GPIO.Write(act, false)
+	}
+	if reset, ok := r.Pins.RESET.Get(); ok {
+		if err := r.GPIO.SetInput(reset); err != nil { // NRESET, released.
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	Reset().
+	 Resets the module through its NRESET line: pulls it low for RF95W_RESET_PULSE, releases it and waits
+	 RF95W_RESET_WAIT. All registers return to their reset values, so init() (or SetParams()) must follow.
+*/
+
+func (r *RFM95W) Reset() error {
+	reset, ok := r.Pins.RESET.Get()
+	if !ok {
+		return errors.New("Reset(): no reset pin configured.")
+	}
+	if err := r.GPIO.SetOutput(reset); err != nil {
+		return err
+	}
+	r.GPIO.Write(reset, false)
+	time.Sleep(RF95W_RESET_PULSE)
+	// Release the line, it is pulled up inside the module.
+	if err := r.GPIO.SetInput(reset); err != nil {
+		return err
+	}
+	time.Sleep(RF95W_RESET_WAIT)
+	return nil
+}
+
+/*
+	setCS().
+	 Drives the chip select line, if it is under software control. CS is active low.
+*/
+
+func (r *RFM95W) setCS(active bool) {
+	if cs, ok := r.Pins.CS.Get(); ok {
+		r.GPIO.Write(cs, !active)
+	}
+}
+
+/*
+	setACT().
+	 Turns the ACT LED on or off, if there is one.
+*/
+
+func (r *RFM95W) setACT(on bool) {
+	if act, ok := r.Pins.ACT.Get(); ok {
+		r.GPIO.Write(act, on)
+	}
+}
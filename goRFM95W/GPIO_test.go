@@ -0,0 +1,150 @@
+package goRFM95W
+
+import (
+	"testing"
+)
+
+func TestMultipleModules(t *testing.T) {
+	r1, e1 := newTestModule(t, nil)
+	r2, e2 := newTestModule(t, nil)
+	startReceiving(t, r1, e1)
+	startReceiving(t, r2, e2)
+
+	if err := r1.Send([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if tx := waitTransmitted(t, e1, 1); string(tx[0]) != "one" {
+		t.Fatalf("Module 1 transmitted %q.", tx)
+	}
+	if tx := e2.Transmitted(); len(tx) != 0 {
+		t.Fatalf("Module 2 transmitted %q.", tx)
+	}
+	if err := e2.Receive(EmulatorPacket{Payload: []byte("two")}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := waitReceived(t, r2, 1); string(msgs[0].Buf) != "two" {
+		t.Fatalf("Module 2 received %+v.", msgs)
+	}
+	if msgs := r1.FlushRXBuffer(); len(msgs) != 0 {
+		t.Fatalf("Module 1 received %+v.", msgs)
+	}
+}
+
+func TestPinConflict(t *testing.T) {
+	e := NewSX1276Emulator()
+	pins := RF95W_EMULATOR_PINS
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same pins on the same GPIO.
+	if _, err := New(nil, &RFM95W_Options{SPI: NewSX1276Emulator(), GPIO: e, Pins: &pins}); err == nil {
+		t.Fatal("Pins already in use accepted.")
+	}
+	// The same pin used twice by one module.
+	dup := pins
+	dup.ACT = dup.DIO0
+	g := NewSX1276Emulator()
+	if _, err := New(nil, &RFM95W_Options{SPI: g, GPIO: g, Pins: &dup}); err == nil {
+		t.Fatal("Duplicate pin accepted.")
+	}
+	// Close() releases the pins.
+	r.Close()
+	r, err = New(nil, &RFM95W_Options{SPI: NewSX1276Emulator(), GPIO: e, Pins: &pins})
+	if err != nil {
+		t.Fatalf("Pins not released by Close(): %s", err)
+	}
+	r.Close()
+}
+
+func TestNewFailureReleasesPins(t *testing.T) {
+	g := NewSX1276Emulator()
+	bad := NewSX1276Emulator()
+	bad.SetRegister(RF95W_REG_VERSION, 0x00)
+	pins := RF95W_EMULATOR_PINS
+	r, err := New(nil, &RFM95W_Options{SPI: bad, GPIO: g, Pins: &pins})
+	if err == nil || r != nil {
+		t.Fatalf("New() with no chip returned %v, %v.", r, err)
+	}
+	r, err = New(nil, &RFM95W_Options{SPI: g, GPIO: g, Pins: &pins})
+	if err != nil {
+		t.Fatalf("Pins not released by failed New(): %s", err)
+	}
+	r.Close()
+}
+
+func TestUnsetOptionalPins(t *testing.T) {
+	e := NewSX1276Emulator()
+	// Only DIO0 is wired, the other lines are left as zero values.
+	pins := RFM95W_Pins{DIO0: OptionalPin(0)}
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, ok := r.Pins.RESET.Get(); ok {
+		t.Fatal("Unset RESET reported as connected.")
+	}
+	if err := r.Reset(); err == nil {
+		t.Fatal("Reset() without a RESET pin succeeded.")
+	}
+	// Pin 0 is DIO0, so a zero-valued CS, ACT or DIO1 must not be claimed as pin 0.
+	if d := r.dioPins(); d[1] != RF95W_PIN_NONE || d[5] != RF95W_PIN_NONE {
+		t.Fatalf("DIO pins %v.", d)
+	}
+	if r.polling {
+		t.Fatal("Polling with DIO0 connected.")
+	}
+}
+
+func TestNoPins(t *testing.T) {
+	e := NewSX1276Emulator()
+	var pins RFM95W_Pins
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Nothing to claim, and RegIrqFlags is polled without DIO0.
+	mu_Pins.Lock()
+	for k, owner := range claimedPins {
+		if owner == r {
+			t.Errorf("Pin %d claimed.", k.pin)
+		}
+	}
+	mu_Pins.Unlock()
+	if !r.polling {
+		t.Fatal("Not polling without DIO0.")
+	}
+}
+
+func TestSharedBus(t *testing.T) {
+	e := NewSX1276Emulator()
+	pins := RF95W_EMULATOR_PINS
+	r1, err := New(nil, &RFM95W_Options{SPI: e, GPIO: NewSX1276Emulator(), Pins: &pins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := New(nil, &RFM95W_Options{SPI: e, GPIO: NewSX1276Emulator(), Pins: &pins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.bus != r2.bus {
+		t.Fatal("Modules on one SPIBus don't share the bus lock.")
+	}
+	// The bus stays open for the other module.
+	r1.Close()
+	if v, err := r2.GetRegister(RF95W_REG_VERSION); err != nil || v != RF95W_CHIP_VERSION {
+		t.Fatalf("RegVersion %02x, %v after closing the other module.", v, err)
+	}
+	r2.Close()
+	if _, err := r2.GetRegister(RF95W_REG_VERSION); err == nil {
+		t.Fatal("Bus not closed with its last user.")
+	}
+	mu_Buses.Lock()
+	_, ok := sharedBuses[e]
+	mu_Buses.Unlock()
+	if ok {
+		t.Fatal("Bus left registered.")
+	}
+}
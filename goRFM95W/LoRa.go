@@ -4,7 +4,12 @@ package goRFM95W
 
 import (
 	"errors"
-	"fmt"
+	"time"
+)
+
+const (
+	RF95W_CAD_TIMEOUT_SYMBOLS = 4                    // CAD takes about 2 symbols.
+	RF95W_CAD_POLL            = 1 * time.Millisecond // How often RegIrqFlags is read for CadDone.
 )
 
 /*
@@ -13,53 +18,300 @@ import (
 */
 
 func (r *RFM95W) SetCodingRate(cr int) error {
+	if !r.isLoRa() {
+		return errors.New("SetCodingRate(): not in LoRa mode.")
+	}
 	if cr < 5 || cr > 8 {
 		return errors.New("Invalid coding rate requested.")
 	}
 	b := byte(cr - 4) // 5 = 0x1, 6 = 0x2, 7 = 0x3, 8 = 0x4
-	// Get initial value.
-	val, err := r.GetRegister(0x1D) // RegModemConfig1.
+	err := r.SetField(RF95W_FIELD_CODINGRATE, b)
+	if err == nil {
+		r.settings.CodingRate = cr
+	}
+	return err
+}
+
+/*
+	SetSpreadingFactor().
+	 Sets the spreading factor. Valid values are 6, 7, 8, 9, 10, 11, 12, limited by the module variant.
+*/
+
+func (r *RFM95W) SetSpreadingFactor(sf int) error {
+	if !r.isLoRa() {
+		return errors.New("SetSpreadingFactor(): not in LoRa mode.")
+	}
+	if !r.validSpreadingFactor(sf) {
+		return errors.New("Invalid spreading factor requested.")
+	}
+	if sf == 6 && !validPayloadLength(r.settings.PayloadLength) {
+		return errors.New("SF6 requires a fixed payload length (PayloadLength).")
+	}
+	err := r.SetField(RF95W_FIELD_SPREADINGFACTOR, byte(sf))
 	if err != nil {
 		return err
 	}
-	// Set only the coding rate portion.
-	new_val := (val & 0xF1) | (b << 1)
-	if r.Debug {
-		fmt.Printf("SetCodingRate(): %02x -> %02x\n", val, new_val)
+	err = r.setSF6(sf == 6)
+	if err != nil {
+		return err
 	}
-	_, err = r.SetRegister(0x1D, new_val) // RegModemConfig1.
+	r.settings.SpreadingFactor = sf
+	// SF6 forces implicit header mode.
+	err = r.setHeaderMode()
 	if err != nil {
-		r.settings.CodingRate = cr
+		return err
+	}
+	// The symbol time changed.
+	return r.setModemConfig3()
+}
+
+/*
+	setSF6().
+	 SF6 has its own detection settings. Switches these on for SF6 and back to the SF7-SF12 settings otherwise.
+*/
+
+func (r *RFM95W) setSF6(on bool) error {
+	detectOptimize := byte(RF95W_DETECTOPTIMIZE_SF7TO12)
+	detectionThreshold := byte(RF95W_DETECTIONTHRESHOLD_SF7TO12)
+	if on {
+		detectOptimize = RF95W_DETECTOPTIMIZE_SF6
+		detectionThreshold = RF95W_DETECTIONTHRESHOLD_SF6
+	}
+	err := r.SetField(RF95W_FIELD_DETECTIONOPTIMIZE, detectOptimize)
+	if err != nil {
+		return err
 	}
+	_, err = r.SetRegister(RF95W_REG_DETECTIONTHRESHOLD, detectionThreshold)
 	return err
 }
 
 /*
-	SetSpreadingFactor().
-	 Sets the spreading factor. Valid values are 6, 7, 8, 9, 10, 11, 12.
+	SetExplicitHeaderMode().
+	 True or false - include explicit header. Without a header (implicit header mode), packets have a fixed length
+	 of PayloadLength bytes and the same coding rate and CRC setting must be used on both ends. SF6 only works in
+	 implicit header mode.
 */
 
-func (r *RFM95W) SetSpreadingFactor(sf int) error {
-	if sf == 6 {
-		panic("SF=6 not implemented.")
+func (r *RFM95W) SetExplicitHeaderMode(wantHeader bool) error {
+	if !r.isLoRa() {
+		return errors.New("SetExplicitHeaderMode(): not in LoRa mode.")
 	}
-	if sf < 6 || sf > 12 {
-		return errors.New("Invalid spreading factor requested.")
+	if wantHeader && r.settings.SpreadingFactor == 6 {
+		return errors.New("SF6 requires implicit header mode.")
+	}
+	old := r.settings.HeaderMode
+	r.settings.HeaderMode = RF95W_HEADER_IMPLICIT
+	if wantHeader {
+		r.settings.HeaderMode = RF95W_HEADER_EXPLICIT
+	}
+	err := r.setHeaderMode()
+	if err != nil {
+		r.settings.HeaderMode = old
+	}
+	return err
+}
+
+/*
+	setHeaderMode().
+	 Programs the header mode, and the fixed payload length in implicit header mode, from the current settings.
+*/
+
+func (r *RFM95W) setHeaderMode() error {
+	implicit := r.implicitHeader()
+	if implicit {
+		if !validPayloadLength(r.settings.PayloadLength) {
+			return errors.New("Implicit header mode requires a fixed payload length (PayloadLength).")
+		}
+		_, err := r.SetRegister(RF95W_REG_PAYLOADLENGTH, byte(r.settings.PayloadLength))
+		if err != nil {
+			return err
+		}
+	}
+	return r.SetFlag(RF95W_FIELD_IMPLICITHEADERMODEON, implicit)
+}
+
+/*
+	implicitHeader().
+	 True if packets have no header, and so a fixed length of PayloadLength.
+*/
+
+func (r *RFM95W) implicitHeader() bool {
+	return r.settings.HeaderMode == RF95W_HEADER_IMPLICIT || r.settings.SpreadingFactor == 6
+}
+
+func validPayloadLength(l int) bool {
+	return l >= 1 && l <= 255
+}
+
+/*
+	validSpreadingFactor().
+	 Checks the spreading factor against the range supported by the module variant.
+*/
+
+func (r *RFM95W) validSpreadingFactor(sf int) bool {
+	v := RFM95W_Variants[r.variant]
+	return sf >= v.MinSF && sf <= v.MaxSF
+}
+
+/*
+	SymbolTime().
+	 LoRa symbol duration, 2^SF / BW, for the given bandwidth (Hz) and spreading factor.
+*/
+
+func SymbolTime(bw, sf int) time.Duration {
+	if bw <= 0 {
+		return 0
+	}
+	return time.Duration(int64(1<<uint(sf)) * int64(time.Second) / int64(bw))
+}
+
+/*
+	setModemConfig3().
+	 Sets LowDataRateOptimize and AgcAutoOn from the current settings. In RF95W_SETTING_AUTO, LowDataRateOptimize
+	 is on when the symbol time exceeds RF95W_LDRO_SYMBOL_TIME, as required by the datasheet, and the AGC is on.
+*/
+
+func (r *RFM95W) setModemConfig3() error {
+	ldro := r.settings.LowDataRateOptimize == RF95W_SETTING_ON
+	if r.settings.LowDataRateOptimize == RF95W_SETTING_AUTO {
+		ldro = SymbolTime(r.settings.Bandwidth, r.settings.SpreadingFactor) > RF95W_LDRO_SYMBOL_TIME
+	}
+	agc := r.settings.AGC != RF95W_SETTING_OFF
+	err := r.SetFlag(RF95W_FIELD_LOWDATARATEOPTIMIZE, ldro)
+	if err != nil {
+		return err
+	}
+	return r.SetFlag(RF95W_FIELD_AGCAUTOON, agc)
+}
+
+/*
+	SetCRC().
+	 Enables or disables the payload CRC.
+*/
+
+func (r *RFM95W) SetCRC(on bool) error {
+	f := RF95W_FIELD_RXPAYLOADCRCON
+	if !r.isLoRa() {
+		f = RF95W_FIELD_CRCON
+	}
+	err := r.SetFlag(f, on)
+	if err == nil {
+		r.settings.CRC = on
+	}
+	return err
+}
+
+/*
+	SetSyncWord().
+	 Sets the sync word. Only packets with the same sync word are received. RF95W_SYNCWORD_PRIVATE keeps out of
+	 LoRaWAN public networks (RF95W_SYNCWORD_LORAWAN). Other values can be used to separate networks.
+*/
+
+func (r *RFM95W) SetSyncWord(syncWord byte) error {
+	if !r.isLoRa() {
+		return errors.New("SetSyncWord(): not in LoRa mode, see SetFSKSyncWord().")
+	}
+	_, err := r.SetRegister(RF95W_REG_SYNCWORD, syncWord)
+	if err == nil {
+		r.settings.SyncWord = int(syncWord)
+	}
+	return err
+}
+
+/*
+	setInvertIQ().
+	 Sets up RegInvertIQ and RegInvertIQ2 for transmitting (tx) or receiving, following InvertIQTX or InvertIQRX.
+	 As in Semtech's reference driver, the InvertIQTX bit is set for normal IQ, not inverted as in the datasheet.
+*/
+
+func (r *RFM95W) setInvertIQ(tx bool) error {
+	if !r.isLoRa() {
+		return nil
+	}
+	inverted := r.settings.InvertIQRX
+	if tx {
+		inverted = r.settings.InvertIQTX
 	}
-	b := byte(sf)
-	// Get initial value.
-	val, err := r.GetRegister(0x1E) // RegModemConfig2.
+	val, err := r.GetRegister(RF95W_REG_INVERTIQ)
 	if err != nil {
 		return err
 	}
-	// Set only the spreading factor portion.
-	new_val := (val & 0x0F) | (b << 4)
-	if r.Debug {
-		fmt.Printf("SetSpreadingFactor(): %02x -> %02x\n", val, new_val)
+	var rxBit, txBit byte
+	if !tx && inverted {
+		rxBit = 1
 	}
-	_, err = r.SetRegister(0x1E, new_val) // RegModemConfig2.
+	if !(tx && inverted) {
+		txBit = 1
+	}
+	val = RF95W_FIELD_INVERTIQRX.Set(val, rxBit)
+	val = RF95W_FIELD_INVERTIQTX.Set(val, txBit)
+	_, err = r.SetRegister(RF95W_REG_INVERTIQ, val)
 	if err != nil {
-		r.settings.SpreadingFactor = sf
+		return err
 	}
+	val2 := byte(RF95W_INVERTIQ2_OFF)
+	if inverted {
+		val2 = RF95W_INVERTIQ2_ON
+	}
+	_, err = r.SetRegister(RF95W_REG_INVERTIQ2, val2)
 	return err
 }
+
+/*
+	ChannelActive().
+	 Runs a channel activity detection (CAD) and returns true if a LoRa preamble was detected, e.g. to listen
+	 before talk. This runs through queueHandler, so that it doesn't interrupt TX or a packet being received.
+	 Afterwards the module goes back to receiving.
+*/
+
+func (r *RFM95W) ChannelActive() (bool, error) {
+	if !r.isLoRa() {
+		return false, errors.New("ChannelActive(): not in LoRa mode.")
+	}
+	var detected bool
+	err := r.runJob(func() error {
+		r.mu_Send.Lock()
+		defer r.mu_Send.Unlock()
+
+		var err error
+		detected, err = r.channelActive()
+		return err
+	})
+	return detected, err
+}
+
+/*
+	channelActive().
+	 Starts CAD from STDBY and waits for CadDone in RegIrqFlags. The module returns to STDBY by itself.
+*/
+
+func (r *RFM95W) channelActive() (bool, error) {
+	const cadFlags = RF95W_IRQ_FLAG_CADDONE | RF95W_IRQ_FLAG_CADDETECTED
+	err := r.SetMode(RF95W_MODE_STDBY)
+	if err != nil {
+		return false, err
+	}
+	err = r.clearIRQFlags(cadFlags)
+	if err != nil {
+		return false, err
+	}
+	err = r.SetMode(RF95W_MODE_CAD)
+	if err != nil {
+		return false, err
+	}
+	deadline := time.Now().Add(RF95W_CAD_TIMEOUT_SYMBOLS * SymbolTime(r.settings.Bandwidth, r.settings.SpreadingFactor))
+	for {
+		flags, err := r.getIRQFlags()
+		if err != nil {
+			return false, err
+		}
+		if flags&RF95W_IRQ_FLAG_CADDONE != 0 {
+			return flags&RF95W_IRQ_FLAG_CADDETECTED != 0, r.clearIRQFlags(cadFlags)
+		}
+		if time.Now().After(deadline) {
+			r.SetMode(RF95W_MODE_STDBY)
+			return false, errors.New("ChannelActive(): CAD timed out.")
+		}
+		time.Sleep(RF95W_CAD_POLL)
+	}
+}
@@ -0,0 +1,177 @@
+package goRFM95W
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpreadingFactor6(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	// SF6 needs implicit header mode, so a payload length.
+	if err := r.SetSpreadingFactor(6); err == nil {
+		t.Fatal("SF6 accepted without a payload length.")
+	}
+	p := r.settings
+	p.SpreadingFactor = 6
+	p.PayloadLength = 4
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	if e.Register(RF95W_REG_MODEMCONFIG2)>>4 != 6 || e.Register(RF95W_REG_MODEMCONFIG1)&0x01 == 0 || e.Register(RF95W_REG_PAYLOADLENGTH) != 4 {
+		t.Fatalf("RegModemConfig1 %02x, RegModemConfig2 %02x, RegPayloadLength %d.", e.Register(RF95W_REG_MODEMCONFIG1), e.Register(RF95W_REG_MODEMCONFIG2), e.Register(RF95W_REG_PAYLOADLENGTH))
+	}
+	if e.Register(RF95W_REG_DETECTOPTIMIZE)&0x07 != 0x05 || e.Register(RF95W_REG_DETECTIONTHRESHOLD) != 0x0C {
+		t.Fatalf("RegDetectOptimize %02x, RegDetectionThreshold %02x.", e.Register(RF95W_REG_DETECTOPTIMIZE), e.Register(RF95W_REG_DETECTIONTHRESHOLD))
+	}
+	if err := r.Send([]byte("abc")); err == nil {
+		t.Fatal("Message not matching the payload length accepted.")
+	}
+
+	// Back to SF7 restores explicit header mode and the detection settings.
+	if err := r.SetSpreadingFactor(7); err != nil {
+		t.Fatal(err)
+	}
+	if e.Register(RF95W_REG_MODEMCONFIG1)&0x01 != 0 || e.Register(RF95W_REG_DETECTOPTIMIZE) != 0xC3 || e.Register(RF95W_REG_DETECTIONTHRESHOLD) != 0x0A {
+		t.Fatalf("RegModemConfig1 %02x, RegDetectOptimize %02x, RegDetectionThreshold %02x.", e.Register(RF95W_REG_MODEMCONFIG1), e.Register(RF95W_REG_DETECTOPTIMIZE), e.Register(RF95W_REG_DETECTIONTHRESHOLD))
+	}
+}
+
+func TestModemConfig3(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	// SF7 at 500 kHz: AGC on, no LowDataRateOptimize.
+	if v := e.Register(RF95W_REG_MODEMCONFIG3); v != 0x04 {
+		t.Fatalf("RegModemConfig3 %02x, expected 04.", v)
+	}
+	// SF12 at 125 kHz: symbols over 16 ms need LowDataRateOptimize.
+	p := r.settings
+	p.Bandwidth = 125000
+	p.SpreadingFactor = 12
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	if v := e.Register(RF95W_REG_MODEMCONFIG3); v != 0x0C {
+		t.Fatalf("RegModemConfig3 %02x, expected 0c.", v)
+	}
+	p.LowDataRateOptimize = RF95W_SETTING_OFF
+	p.AGC = RF95W_SETTING_OFF
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	if v := e.Register(RF95W_REG_MODEMCONFIG3); v != 0x00 {
+		t.Fatalf("RegModemConfig3 %02x, expected 00.", v)
+	}
+	p.AGC = 5
+	if err := r.SetParams(p); err == nil {
+		t.Fatal("Invalid AGC setting accepted.")
+	}
+}
+
+func TestHeaderMode(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	startReceiving(t, r, e)
+	if err := e.Receive(EmulatorPacket{Payload: []byte("hi"), CodingRate: 7, CRC: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Explicit header: coding rate and CRC presence come from the header.
+	if msgs := waitReceived(t, r, 1); msgs[0].CodingRate != 7 || !msgs[0].CRCPresent {
+		t.Fatalf("Received %+v.", msgs[0])
+	}
+
+	p := r.settings
+	p.HeaderMode = RF95W_HEADER_IMPLICIT
+	p.PayloadLength = 2
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	if e.Register(RF95W_REG_MODEMCONFIG1)&0x01 == 0 || e.Register(RF95W_REG_PAYLOADLENGTH) != 2 {
+		t.Fatalf("RegModemConfig1 %02x, RegPayloadLength %d.", e.Register(RF95W_REG_MODEMCONFIG1), e.Register(RF95W_REG_PAYLOADLENGTH))
+	}
+	if err := e.Receive(EmulatorPacket{Payload: []byte("hi"), CodingRate: 7, CRC: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Implicit header: nothing to report.
+	if msgs := waitReceived(t, r, 1); string(msgs[0].Buf) != "hi" || msgs[0].CodingRate != 0 {
+		t.Fatalf("Received %+v.", msgs[0])
+	}
+
+	if err := r.SetExplicitHeaderMode(true); err != nil {
+		t.Fatal(err)
+	}
+	if e.Register(RF95W_REG_MODEMCONFIG1)&0x01 != 0 || r.settings.HeaderMode != RF95W_HEADER_EXPLICIT {
+		t.Fatalf("RegModemConfig1 %02x after SetExplicitHeaderMode(true).", e.Register(RF95W_REG_MODEMCONFIG1))
+	}
+}
+
+func TestCRC(t *testing.T) {
+	p := RFM95W_Params{Frequency: 915000000, Bandwidth: 500000, SpreadingFactor: 7, CodingRate: 5, PreambleLength: 8, CRC: true}
+	r, e := newTestModule(t, &p)
+	if e.Register(RF95W_REG_MODEMCONFIG2)&0x04 == 0 {
+		t.Fatalf("RegModemConfig2 %02x, expected RxPayloadCrcOn.", e.Register(RF95W_REG_MODEMCONFIG2))
+	}
+	startReceiving(t, r, e)
+
+	// Packets with a CRC error are dropped, unless DeliverCRCErrors is set.
+	if err := e.Receive(EmulatorPacket{Payload: []byte("bad"), CRC: true, CRCError: true}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "IRQ flags cleared", func() bool { return e.Register(RF95W_REG_IRQFLAGS) == 0 })
+	if err := e.Receive(EmulatorPacket{Payload: []byte("ok"), CRC: true}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := waitReceived(t, r, 1); len(msgs) != 1 || string(msgs[0].Buf) != "ok" || !msgs[0].CRCValid {
+		t.Fatalf("Received %+v.", msgs)
+	}
+
+	r.DeliverCRCErrors = true
+	if err := e.Receive(EmulatorPacket{Payload: []byte("bad"), CRC: true, CRCError: true}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := waitReceived(t, r, 1); string(msgs[0].Buf) != "bad" || msgs[0].CRCValid {
+		t.Fatalf("Received %+v.", msgs)
+	}
+}
+
+func TestSyncWord(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	if v := e.Register(RF95W_REG_SYNCWORD); v != RF95W_SYNCWORD_PRIVATE {
+		t.Fatalf("RegSyncWord %02x, expected %02x.", v, RF95W_SYNCWORD_PRIVATE)
+	}
+	p := r.settings
+	p.SyncWord = RF95W_SYNCWORD_LORAWAN
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	if v := e.Register(RF95W_REG_SYNCWORD); v != RF95W_SYNCWORD_LORAWAN {
+		t.Fatalf("RegSyncWord %02x, expected %02x.", v, RF95W_SYNCWORD_LORAWAN)
+	}
+	p.SyncWord = 0x100
+	if err := r.SetParams(p); err == nil {
+		t.Fatal("Sync word 0x100 accepted.")
+	}
+	if err := r.SetSyncWord(0x12); err != nil || e.Register(RF95W_REG_SYNCWORD) != 0x12 {
+		t.Fatalf("SetSyncWord(0x12): %v, RegSyncWord %02x.", err, e.Register(RF95W_REG_SYNCWORD))
+	}
+}
+
+func TestInvertIQ(t *testing.T) {
+	p := RFM95W_Params{Frequency: 915000000, Bandwidth: 500000, SpreadingFactor: 7, CodingRate: 5, PreambleLength: 8, InvertIQTX: true}
+	r, e := newTestModule(t, &p)
+	e.TxDelay = 20 * time.Millisecond
+	startReceiving(t, r, e)
+	// Normal IQ when receiving.
+	if e.Register(RF95W_REG_INVERTIQ) != 0x27 || e.Register(RF95W_REG_INVERTIQ2) != 0x1D {
+		t.Fatalf("RX: RegInvertIQ %02x, RegInvertIQ2 %02x.", e.Register(RF95W_REG_INVERTIQ), e.Register(RF95W_REG_INVERTIQ2))
+	}
+	if err := r.Send([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "TX", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_TX })
+	if e.Register(RF95W_REG_INVERTIQ) != 0x26 || e.Register(RF95W_REG_INVERTIQ2) != 0x19 {
+		t.Fatalf("TX: RegInvertIQ %02x, RegInvertIQ2 %02x.", e.Register(RF95W_REG_INVERTIQ), e.Register(RF95W_REG_INVERTIQ2))
+	}
+	waitTransmitted(t, e, 1)
+	waitFor(t, "RXCONTINUOUS after TX", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+	if e.Register(RF95W_REG_INVERTIQ) != 0x27 {
+		t.Fatalf("RegInvertIQ %02x after TX.", e.Register(RF95W_REG_INVERTIQ))
+	}
+}
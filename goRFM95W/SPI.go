@@ -3,17 +3,146 @@
 package goRFM95W
 
 import (
-	"github.com/cyoung/rpi"
+	"errors"
+	"golang.org/x/exp/io/spi"
+	"sync"
 )
 
+const (
+	RF95W_SPI_DEV   = "/dev/spidev0.0"
+	RF95W_SPI_SPEED = 8000000 // Hz
+)
+
+/*
+	SPIBus.
+	 Transport used to talk to the module. Tx writes w and reads the same number of bytes into r in one
+	 transaction. The devfs *spi.Device from golang.org/x/exp/io/spi satisfies this interface.
+	 An SPIBus passed to several modules is shared between them, so implementations must be comparable (e.g.
+	 pointer types).
+*/
+
+type SPIBus interface {
+	Tx(w, r []byte) error
+	Close() error
+}
+
+/*
+	SPISpeedSetter.
+	 Optionally implemented by an SPIBus that can change its clock speed.
+*/
+
+type SPISpeedSetter interface {
+	SetMaxSpeed(speed int) error
+}
+
+// An SPI bus and the modules using it.
+type sharedBus struct {
+	mu    *sync.Mutex // Held for each transfer, including the software chip select around it.
+	users int
+}
+
+var (
+	// SPI buses in use by all RFM95W instances in this process, by device path or SPIBus value.
+	mu_Buses    = &sync.Mutex{}
+	sharedBuses = make(map[interface{}]*sharedBus)
+)
+
+/*
+	claimBus().
+	 Registers this instance as a user of the SPI bus identified by key: the device path if New() opened it,
+	 otherwise the SPIBus. Modules on the same bus share its lock, so that their transfers, framed by a software
+	 chip select, don't interleave.
+*/
+
+func (r *RFM95W) claimBus(key interface{}) {
+	mu_Buses.Lock()
+	defer mu_Buses.Unlock()
+
+	b, ok := sharedBuses[key]
+	if !ok {
+		b = &sharedBus{mu: &sync.Mutex{}}
+		sharedBuses[key] = b
+	}
+	b.users++
+	r.bus, r.busKey, r.busClaimed = b, key, true
+}
+
+/*
+	closeBus().
+	 Releases the bus claimed by claimBus(). A device opened by New() is closed, an SPIBus passed to New() only
+	 when its last user is done with it.
+*/
+
+func (r *RFM95W) closeBus() error {
+	mu_Buses.Lock()
+	if !r.busClaimed {
+		mu_Buses.Unlock()
+		return nil
+	}
+	r.busClaimed = false
+	r.bus.users--
+	last := r.bus.users == 0
+	if last {
+		delete(sharedBuses, r.busKey)
+	}
+	mu_Buses.Unlock()
+
+	if !last && !r.ownBus {
+		return nil
+	}
+	return r.SPI.Close()
+}
+
+/*
+	OpenSPI().
+	 Opens a devfs SPI device (e.g. "/dev/spidev0.0") in the given SPI mode (0-3), MSB first, at the given
+	 speed (Hz). This is the default transport used by New().
+*/
+
+func OpenSPI(dev string, mode int, speed int64) (SPIBus, error) {
+	if mode < 0 || mode > 3 {
+		return nil, errors.New("Invalid SPI mode requested.")
+	}
+	spiDev := &spi.Devfs{
+		Dev:      dev,
+		Mode:     spi.Mode(mode),
+		MaxSpeed: speed,
+	}
+
+	SPI, err := spi.Open(spiDev)
+	if err != nil {
+		return nil, err
+	}
+
+	SPI.SetBitOrder(spi.MSBFirst)
+	SPI.SetCSChange(false)
+
+	return SPI, nil
+}
+
+/*
+	SetSPISpeed().
+	 Changes the SPI clock speed (Hz), if the transport supports it.
+*/
+
+func (r *RFM95W) SetSPISpeed(speed int) error {
+	s, ok := r.SPI.(SPISpeedSetter)
+	if !ok {
+		return errors.New("SPI transport does not support changing speed.")
+	}
+	return s.SetMaxSpeed(speed)
+}
+
 /*
 	GetBytes().
 	 Bulk SPI read function.
 */
 
 func (r *RFM95W) GetBytes(reg byte, len int) ([]byte, error) {
-	rpi.DigitalWrite(RF95W_CS_PIN, rpi.LOW)
-	defer rpi.DigitalWrite(RF95W_CS_PIN, rpi.HIGH)
+	r.bus.mu.Lock()
+	defer r.bus.mu.Unlock()
+	r.setCS(true)
+	defer r.setCS(false)
 
 	buf := make([]byte, len+1)
 	bufTX := make([]byte, len+1)
@@ -31,8 +160,10 @@ func (r *RFM95W) GetBytes(reg byte, len int) ([]byte, error) {
 */
 
 func (r *RFM95W) SetBytes(reg byte, val []byte) ([]byte, error) {
-	rpi.DigitalWrite(RF95W_CS_PIN, rpi.LOW)
-	defer rpi.DigitalWrite(RF95W_CS_PIN, rpi.HIGH)
+	r.bus.mu.Lock()
+	defer r.bus.mu.Unlock()
+	r.setCS(true)
+	defer r.setCS(false)
 
 	outBuf := []byte{reg | SPI_WRITE_MASK}
 	outBuf = append(outBuf, val...)
@@ -1,9 +1,14 @@
 package goRFM95W
 
+import (
+	"time"
+)
+
 const (
 	RF95W_MODE_FSK          = 0x00
-	RF95W_MODE_OOK          = 0x10
+	RF95W_MODE_OOK          = 0x20
 	RF95W_MODE_LORA         = 0x80
+	RF95W_MODE_LF           = 0x08 // LowFrequencyModeOn. Added by SetMode() for the LF band.
 	RF95W_MODE_SLEEP        = 0x00
 	RF95W_MODE_STDBY        = 0x01
 	RF95W_MODE_FSTX         = 0x02
@@ -24,9 +29,58 @@ const (
 	RF95W_IRQ_FLAG_FHSSCHANGECHANNEL = 0x02
 	RF95W_IRQ_FLAG_CADDETECTED       = 0x01
 
+	// Tri-state settings.
+	RF95W_SETTING_AUTO = 0
+	RF95W_SETTING_ON   = 1
+	RF95W_SETTING_OFF  = 2
+
+	// LoRa header modes.
+	RF95W_HEADER_EXPLICIT = 0
+	RF95W_HEADER_IMPLICIT = 1
+
+	// LoRa sync words.
+	RF95W_SYNCWORD_PRIVATE = 0x12
+	RF95W_SYNCWORD_LORAWAN = 0x34 // LoRaWAN public networks.
+
+	// RegInvertIQ2 values.
+	RF95W_INVERTIQ2_OFF = 0x1D
+	RF95W_INVERTIQ2_ON  = 0x19
+
+	RF95W_LDRO_SYMBOL_TIME = 16 * time.Millisecond // LowDataRateOptimize is mandatory above this symbol time.
+
+	// RegDetectOptimize DetectionOptimize and RegDetectionThreshold values.
+	RF95W_DETECTOPTIMIZE_SF7TO12     = 0x03
+	RF95W_DETECTOPTIMIZE_SF6         = 0x05
+	RF95W_DETECTIONTHRESHOLD_SF7TO12 = 0x0A
+	RF95W_DETECTIONTHRESHOLD_SF6     = 0x0C
+
+	RF95W_PADAC_DEFAULT = 0x4 // RegPaDac PaDac values.
+	RF95W_PADAC_20DBM   = 0x7 // +20 dBm on PA_BOOST.
+
+	RF95W_OCP_DEFAULT = 100 // mA
+	RF95W_OCP_20DBM   = 140 // mA
+
 	MAX_TXQUEUE_PILEUP = 100000 // About 25MB of messages. Start dropping messages in the queue once reaching this.
 )
 
+// RFM95W_Params.TransmitMode values. The zero value selects LoRa. These don't overlap the RegOpMode bits: the
+// RF95W_MODE_* modem values are not accepted.
+type RFM95W_TransmitMode int
+
+const (
+	RF95W_TRANSMIT_LORA RFM95W_TransmitMode = 1
+	RF95W_TRANSMIT_FSK  RFM95W_TransmitMode = 2
+	RF95W_TRANSMIT_OOK  RFM95W_TransmitMode = 3
+)
+
+// RFM95W_Params.TransmitMode -> modem (RegOpMode LongRangeMode and ModulationType bits).
+var RFM95W_TransmitModes = map[RFM95W_TransmitMode]int{
+	0:                   RF95W_MODE_LORA,
+	RF95W_TRANSMIT_LORA: RF95W_MODE_LORA,
+	RF95W_TRANSMIT_FSK:  RF95W_MODE_FSK,
+	RF95W_TRANSMIT_OOK:  RF95W_MODE_OOK,
+}
+
 // bandwidth (Hz) -> setting.
 var RFM95W_Bandwidths = map[int]byte{
 	7800:   0x0,
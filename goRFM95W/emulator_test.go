@@ -0,0 +1,742 @@
+// In-memory SX1276 model for testing the driver without hardware. Only built into the tests.
+
+package goRFM95W
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+	SX1276Emulator.
+	 Register-level model of the SX1276 that implements both SPIBus and GPIO, so that it can be passed to New().
+	 Models RegOpMode transitions, the separate LoRa and FSK register pages, the 256 byte LoRa FIFO, RegIrqFlags
+	 write-to-clear semantics, CAD and the DIO0-DIO5 mapping in RegDioMapping1/2. In FSK/OOK mode, packet mode TX and RX
+	 through the 64 byte FIFO, with PacketSent and PayloadReady on DIO0.
+
+	 GPIO pins 0-5 are interpreted as DIO line numbers: Interrupt(0) returns the DIO0 interrupt channel.
+	 Pin RF95W_EMULATOR_RESET_PIN is NRESET. Use RF95W_EMULATOR_PINS as the pin map.
+*/
+
+type SX1276Emulator struct {
+	TxDelay time.Duration // Simulated time on air for transmissions. Zero completes them immediately.
+	Stuck   bool          // Simulates a hung chip: RegOpMode writes are ignored until the next reset.
+	Busy    bool          // Result of CAD: a LoRa preamble is on the channel.
+	// Received power (dBm) at a frequency (Hz), reported in RegRssiValue. Nil reads the register as stored.
+	Spectrum func(freq uint64) int
+	// °C. Reported in RegTemp, -1 °C per LSB.
+	Temperature int
+
+	mu          sync.Mutex
+	regs        [0x80]byte // Common registers (0x01-0x0C, 0x40-0x7F).
+	loraPage    [0x40]byte // LoRa registers 0x0D-0x3F.
+	fskPage     [0x40]byte // FSK/OOK registers 0x0D-0x3F.
+	fifo        [256]byte
+	fskFifo     []byte
+	rxWritePtr  byte
+	dio         [6]chan GPIOEvent
+	pinLevels   map[int]bool
+	inReset     bool
+	transmitted [][]byte
+	txTimer     *time.Timer
+	closed      bool
+}
+
+/*
+	EmulatorPacket.
+	 A packet "received over the air" by the emulator.
+*/
+
+type EmulatorPacket struct {
+	Payload    []byte
+	RSSI       int     // dBm
+	SNR        float64 // dB
+	CRCError   bool
+	CodingRate int  // Coding rate in the explicit header, 5-8. 0 for the receiver's setting.
+	CRC        bool // The explicit header says that the payload has a CRC.
+	// Hz. Offset of the transmitter from the receiver's frequency, reported in RegFei.
+	FrequencyError int
+}
+
+const RF95W_EMULATOR_RESET_PIN = 6
+
+// Pin map to use with SX1276Emulator. Chip select and the ACT LED are not used.
+var RF95W_EMULATOR_PINS = RFM95W_Pins{
+	DIO0:  OptionalPin(0),
+	DIO1:  OptionalPin(1),
+	DIO2:  OptionalPin(2),
+	DIO3:  OptionalPin(3),
+	DIO4:  OptionalPin(4),
+	DIO5:  OptionalPin(5),
+	RESET: OptionalPin(RF95W_EMULATOR_RESET_PIN),
+}
+
+func NewSX1276Emulator() *SX1276Emulator {
+	e := &SX1276Emulator{
+		pinLevels: make(map[int]bool),
+	}
+	for i := range e.dio {
+		e.dio[i] = make(chan GPIOEvent, 16)
+	}
+	e.reset()
+	return e
+}
+
+/*
+	reset().
+	 Loads the register reset values from the datasheet.
+*/
+
+func (e *SX1276Emulator) reset() {
+	e.regs = [0x80]byte{}
+	e.loraPage = [0x40]byte{}
+	e.fskPage = [0x40]byte{}
+
+	e.regs[0x01] = 0x09 // RegOpMode: FSK, LowFrequencyModeOn, STDBY.
+	e.regs[0x02] = 0x1A // RegBitrateMsb.
+	e.regs[0x03] = 0x0B // RegBitrateLsb.
+	e.regs[0x04] = 0x00 // RegFdevMsb.
+	e.regs[0x05] = 0x52 // RegFdevLsb.
+	e.regs[0x06] = 0x6C // RegFrfMsb.
+	e.regs[0x07] = 0x80 // RegFrfMid.
+	e.regs[0x08] = 0x00 // RegFrfLsb.
+	e.regs[0x09] = 0x4F // RegPaConfig.
+	e.regs[0x0A] = 0x09 // RegPaRamp.
+	e.regs[0x0B] = 0x2B // RegOcp.
+	e.regs[0x0C] = 0x20 // RegLna.
+	e.regs[0x41] = 0x00 // RegDioMapping2.
+	e.regs[0x42] = 0x12 // RegVersion.
+	e.regs[0x4B] = 0x09 // RegTcxo.
+	e.regs[0x4D] = 0x84 // RegPaDac.
+
+	e.loraPage[0x0E] = 0x80 // RegFifoTxBaseAddr.
+	e.loraPage[0x1D] = 0x72 // RegModemConfig1.
+	e.loraPage[0x1E] = 0x70 // RegModemConfig2.
+	e.loraPage[0x1F] = 0x64 // RegSymbTimeoutLsb.
+	e.loraPage[0x21] = 0x08 // RegPreambleLsb.
+	e.loraPage[0x22] = 0x01 // RegPayloadLength.
+	e.loraPage[0x23] = 0xFF // RegMaxPayloadLength.
+	e.loraPage[0x26] = 0x04 // RegModemConfig3.
+	e.loraPage[0x31] = 0xC3 // RegDetectOptimize.
+	e.loraPage[0x33] = 0x27 // RegInvertIQ.
+	e.loraPage[0x37] = 0x0A // RegDetectionThreshold.
+	e.loraPage[0x39] = 0x12 // RegSyncWord.
+	e.loraPage[0x3B] = 0x1D // RegInvertIQ2.
+
+	e.fskPage[0x0D] = 0x0E // RegRxConfig.
+	e.fskPage[0x0E] = 0x02 // RegRssiConfig.
+	e.fskPage[0x10] = 0xFF // RegRssiThresh.
+	e.fskPage[0x12] = 0x15 // RegRxBw.
+	e.fskPage[0x13] = 0x0B // RegAfcBw.
+	e.fskPage[0x14] = 0x28 // RegOokPeak.
+	e.fskPage[0x15] = 0x0C // RegOokFix.
+	e.fskPage[0x16] = 0x12 // RegOokAvg.
+	e.fskPage[0x1F] = 0x40 // RegPreambleDetect.
+	e.fskPage[0x24] = 0x07 // RegOsc.
+	e.fskPage[0x26] = 0x03 // RegPreambleLsb.
+	e.fskPage[0x27] = 0x93 // RegSyncConfig.
+	for i := 0x28; i <= 0x2F; i++ {
+		e.fskPage[i] = 0x55 // RegSyncValue1-8.
+	}
+	e.fskPage[0x30] = 0x90 // RegPacketConfig1.
+	e.fskPage[0x31] = 0x40 // RegPacketConfig2.
+	e.fskPage[0x32] = 0x40 // RegPayloadLength.
+	e.fskPage[0x35] = 0x1F // RegFifoThresh.
+	e.fskPage[0x3B] = 0x02 // RegImageCal.
+	e.fskPage[0x3E] = 0x80 // RegIrqFlags1.
+	e.fskPage[0x3F] = 0x40 // RegIrqFlags2.
+
+	e.fifo = [256]byte{}
+	e.fskFifo = nil
+	e.rxWritePtr = 0
+	if e.txTimer != nil {
+		e.txTimer.Stop()
+		e.txTimer = nil
+	}
+}
+
+/*
+	Tx().
+	 SPIBus implementation. The first byte of w is the register address, with the MSB set for a write.
+	 Burst accesses auto-increment the address, except for RegFifo (0x00).
+*/
+
+func (e *SX1276Emulator) Tx(w, r []byte) error {
+	if len(w) != len(r) {
+		return errors.New("Emulator: Tx() buffers must be the same length.")
+	}
+	if len(w) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return errors.New("Emulator: Tx() on closed device.")
+	}
+	if e.inReset {
+		// No response while NRESET is held low.
+		for i := range r {
+			r[i] = 0
+		}
+		return nil
+	}
+
+	addr := w[0] &^ SPI_WRITE_MASK
+	write := w[0]&SPI_WRITE_MASK != 0
+	r[0] = 0
+	for i := 1; i < len(w); i++ {
+		if write {
+			r[i] = 0
+			e.write(addr, w[i])
+		} else {
+			r[i] = e.read(addr)
+		}
+		if addr != 0x00 { // RegFifo.
+			addr = (addr + 1) & 0x7F
+		}
+	}
+	return nil
+}
+
+func (e *SX1276Emulator) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	if e.txTimer != nil {
+		e.txTimer.Stop()
+	}
+	return nil
+}
+
+// GPIO implementation.
+
+func (e *SX1276Emulator) SetOutput(pin int) error {
+	return nil
+}
+
+func (e *SX1276Emulator) SetInput(pin int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if pin == RF95W_EMULATOR_RESET_PIN && e.inReset {
+		// NRESET released.
+		e.inReset = false
+		e.Stuck = false
+		e.reset()
+	}
+	return nil
+}
+
+func (e *SX1276Emulator) Write(pin int, high bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pinLevels[pin] = high
+	if pin == RF95W_EMULATOR_RESET_PIN && !high {
+		e.inReset = true
+	}
+	return nil
+}
+
+func (e *SX1276Emulator) Interrupt(pin int) (<-chan GPIOEvent, error) {
+	if pin < 0 || pin >= len(e.dio) {
+		return nil, errors.New("Emulator: invalid DIO line.")
+	}
+	return e.dio[pin], nil
+}
+
+/*
+	PinLevel().
+	 Returns the last level written to a GPIO output.
+*/
+
+func (e *SX1276Emulator) PinLevel(pin int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.pinLevels[pin]
+}
+
+/*
+	Register().
+	 Returns the value of a register in the currently selected page, without side effects.
+*/
+
+func (e *SX1276Emulator) Register(addr byte) byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if addr == 0x00 {
+		return 0
+	}
+	return *e.reg(addr)
+}
+
+/*
+	SetRegister().
+	 Sets a register in the currently selected page directly, bypassing the write rules of the chip.
+*/
+
+func (e *SX1276Emulator) SetRegister(addr, val byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if addr != 0x00 {
+		*e.reg(addr) = val
+	}
+}
+
+/*
+	Mode().
+	 Returns the current RegOpMode value.
+*/
+
+func (e *SX1276Emulator) Mode() byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.regs[0x01]
+}
+
+/*
+	Transmitted().
+	 Returns all packets transmitted so far and clears the list.
+*/
+
+func (e *SX1276Emulator) Transmitted() [][]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ret := e.transmitted
+	e.transmitted = nil
+	return ret
+}
+
+/*
+	Receive().
+	 Simulates a packet arriving over the air. The module must be in LoRa RXCONTINUOUS or RXSINGLE mode, or in FSK
+	 RXCONTINUOUS mode.
+*/
+
+func (e *SX1276Emulator) Receive(p EmulatorPacket) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.isLoRa() {
+		return e.receiveFSK(p)
+	}
+	mode := e.regs[0x01] & 0x07
+	if mode != RF95W_MODE_RXCONTINUOUS && mode != RF95W_MODE_RXSINGLE {
+		return errors.New("Emulator: not receiving.")
+	}
+	if len(p.Payload) > 255 {
+		return errors.New("Emulator: payload too long.")
+	}
+
+	start := e.rxWritePtr
+	for _, b := range p.Payload {
+		e.fifo[e.rxWritePtr] = b
+		e.rxWritePtr++
+	}
+	e.loraPage[0x10] = start                         // RegFifoRxCurrentAddr.
+	e.loraPage[0x13] = byte(len(p.Payload))          // RegRxNbBytes.
+	e.loraPage[0x19] = byte(int8(p.SNR * 4))         // RegPktSnrValue.
+	e.loraPage[0x1A] = byte(p.RSSI - e.rssiOffset()) // RegPktRssiValue.
+	fei := e.frequencyErrorValue(p.FrequencyError)
+	e.loraPage[0x28] = byte(fei>>16) & 0x0F // RegFeiMsb.
+	e.loraPage[0x29] = byte(fei >> 8)       // RegFeiMid.
+	e.loraPage[0x2A] = byte(fei)            // RegFeiLsb.
+
+	flags := byte(RF95W_IRQ_FLAG_RXDONE)
+	if e.loraPage[0x1D]&0x01 == 0 { // Explicit header mode.
+		flags |= RF95W_IRQ_FLAG_VALIDHEADER
+		cr := byte(p.CodingRate - 4)
+		if p.CodingRate == 0 {
+			cr = (e.loraPage[0x1D] >> 1) & 0x07
+		}
+		e.loraPage[0x18] = (e.loraPage[0x18] & 0x1F) | cr<<5 // RegModemStat RxCodingRate.
+		e.loraPage[0x1C] &^= 0x40                            // RegHopChannel CrcOnPayload.
+		if p.CRC {
+			e.loraPage[0x1C] |= 0x40
+		}
+	}
+	if p.CRCError {
+		flags |= RF95W_IRQ_FLAG_PAYLOADCRCERROR
+	}
+	e.setIRQ(flags)
+
+	if mode == RF95W_MODE_RXSINGLE {
+		e.setMode(RF95W_MODE_STDBY)
+	}
+	return nil
+}
+
+/*
+	receiveFSK().
+	 Receive() in FSK mode. Packets to another address, and packets failing the CRC check unless CrcAutoClearOff is
+	 set, are dropped like the chip does. Otherwise the packet is put in the FIFO and PayloadReady is set. While
+	 PayloadReady is still set from the previous packet, the receiver is stalled and Receive() fails.
+*/
+
+func (e *SX1276Emulator) receiveFSK(p EmulatorPacket) error {
+	if e.regs[0x01]&0x07 != RF95W_MODE_RXCONTINUOUS {
+		return errors.New("Emulator: not receiving.")
+	}
+	if e.fskPage[0x3F]&RF95W_FSK_IRQ2_PAYLOADREADY != 0 {
+		// The receiver only restarts once the previous packet has left the FIFO.
+		return errors.New("Emulator: FIFO not emptied.")
+	}
+	config := e.fskPage[0x30] // RegPacketConfig1.
+	variable := config&0x80 != 0
+	if variable && len(p.Payload) > RF95W_FSK_FIFO_SIZE-1 || !variable && len(p.Payload) != int(e.fskPage[0x32]) {
+		return errors.New("Emulator: wrong payload length.")
+	}
+	if filter := (config >> 1) & 0x03; filter != 0 {
+		if len(p.Payload) == 0 {
+			return nil
+		}
+		addr := p.Payload[0]
+		if addr != e.fskPage[0x33] && !(filter == 2 && addr == e.fskPage[0x34]) {
+			return nil
+		}
+	}
+	crcOn := config&0x10 != 0
+	if crcOn && p.CRCError && config&0x08 == 0 {
+		return nil
+	}
+
+	e.fskFifo = nil
+	if variable {
+		e.fskFifo = append(e.fskFifo, byte(len(p.Payload)))
+	}
+	e.fskFifo = append(e.fskFifo, p.Payload...)
+	e.fskPage[0x11] = byte(-2 * p.RSSI)                // RegRssiValue.
+	e.fskPage[0x3E] |= RF95W_FSK_IRQ1_SYNCADDRESSMATCH // RegIrqFlags1.
+	e.fskPage[0x3F] |= RF95W_FSK_IRQ2_PAYLOADREADY     // RegIrqFlags2.
+	if crcOn && !p.CRCError {
+		e.fskPage[0x3F] |= RF95W_FSK_IRQ2_CRCOK
+	}
+	if e.dioMapping(0) == RF95W_FSK_DIO0_PAYLOADREADY {
+		e.raise(0)
+	}
+	return nil
+}
+
+/*
+	frequencyErrorValue().
+	 Converts a frequency error (Hz) to the RegFei value at the current bandwidth.
+*/
+
+func (e *SX1276Emulator) frequencyErrorValue(hz int) int32 {
+	bw := 125000
+	for b, v := range RFM95W_Bandwidths {
+		if v == e.loraPage[0x1D]>>4 {
+			bw = b
+		}
+	}
+	return int32(math.Floor(float64(hz)*500000/float64(bw)*RF95W_FXOSC/(1<<24) + 0.5))
+}
+
+// Register access helpers. Must be called with e.mu held.
+
+func (e *SX1276Emulator) isLoRa() bool {
+	return e.regs[0x01]&RF95W_MODE_LORA != 0
+}
+
+/*
+	reg().
+	 Returns the storage for a register, selecting the LoRa or FSK page for 0x0D-0x3F.
+	 AccessSharedReg (RegOpMode bit 6) gives access to the FSK page while in LoRa mode.
+*/
+
+func (e *SX1276Emulator) reg(addr byte) *byte {
+	if addr >= 0x0D && addr <= 0x3F {
+		if e.isLoRa() && e.regs[0x01]&0x40 == 0 {
+			return &e.loraPage[addr]
+		}
+		return &e.fskPage[addr]
+	}
+	return &e.regs[addr]
+}
+
+func (e *SX1276Emulator) isLoRaPage(addr byte) bool {
+	return addr >= 0x0D && addr <= 0x3F && e.isLoRa() && e.regs[0x01]&0x40 == 0
+}
+
+func (e *SX1276Emulator) read(addr byte) byte {
+	if addr == 0x00 && !e.isLoRa() { // RegFifo, FSK.
+		return e.readFSKFifo()
+	}
+	if addr == 0x00 { // RegFifo.
+		ptr := &e.loraPage[0x0D] // RegFifoAddrPtr.
+		v := e.fifo[*ptr]
+		*ptr++
+		return v
+	}
+	if addr == 0x1B && e.isLoRaPage(addr) && e.Spectrum != nil { // RegRssiValue.
+		return byte(e.Spectrum(e.frequency()) - e.rssiOffset())
+	}
+	if addr == 0x11 && !e.isLoRaPage(addr) && e.Spectrum != nil { // RegRssiValue, FSK.
+		return byte(-2 * e.Spectrum(e.frequency()))
+	}
+	if addr == 0x3C && !e.isLoRaPage(addr) { // RegTemp.
+		return byte(int8(-e.Temperature))
+	}
+	if addr == 0x2C && e.isLoRaPage(addr) && e.regs[0x01]&0x07 == RF95W_MODE_RXCONTINUOUS { // RegRssiWideband.
+		return byte(rand.Intn(256)) // Receiver noise.
+	}
+	return *e.reg(addr)
+}
+
+/*
+	readFSKFifo().
+	 Takes a byte from the FSK FIFO. Emptying it after a received packet clears PayloadReady and restarts the
+	 receiver.
+*/
+
+func (e *SX1276Emulator) readFSKFifo() byte {
+	if len(e.fskFifo) == 0 {
+		return 0
+	}
+	v := e.fskFifo[0]
+	e.fskFifo = e.fskFifo[1:]
+	if len(e.fskFifo) == 0 && e.fskPage[0x3F]&RF95W_FSK_IRQ2_PAYLOADREADY != 0 {
+		e.fskPage[0x3F] &^= RF95W_FSK_IRQ2_PAYLOADREADY | RF95W_FSK_IRQ2_CRCOK
+		e.fskPage[0x3E] &^= RF95W_FSK_IRQ1_SYNCADDRESSMATCH
+	}
+	return v
+}
+
+/*
+	rssiOffset().
+	 RSSI register offset (dBm) of the port selected by LowFrequencyModeOn.
+*/
+
+func (e *SX1276Emulator) rssiOffset() int {
+	if e.regs[0x01]&RF95W_MODE_LF != 0 {
+		return RF95W_RSSI_OFFSET_LF
+	}
+	return RF95W_RSSI_OFFSET_HF
+}
+
+/*
+	frequency().
+	 Returns the carrier frequency (Hz) programmed in RegFrf.
+*/
+
+func (e *SX1276Emulator) frequency() uint64 {
+	frf := uint64(e.regs[0x06])<<16 | uint64(e.regs[0x07])<<8 | uint64(e.regs[0x08])
+	return (frf*RF95W_FXOSC + 1<<18) >> 19
+}
+
+func (e *SX1276Emulator) write(addr, val byte) {
+	switch {
+	case addr == 0x00 && !e.isLoRa(): // RegFifo, FSK.
+		if len(e.fskFifo) < RF95W_FSK_FIFO_SIZE {
+			e.fskFifo = append(e.fskFifo, val)
+		} else {
+			e.fskPage[0x3F] |= RF95W_FSK_IRQ2_FIFOOVERRUN
+		}
+	case addr == 0x00: // RegFifo.
+		ptr := &e.loraPage[0x0D] // RegFifoAddrPtr.
+		e.fifo[*ptr] = val
+		*ptr++
+	case addr == 0x01: // RegOpMode.
+		if !e.Stuck {
+			e.writeOpMode(val)
+		}
+	case addr == 0x42: // RegVersion, read-only.
+	case e.isLoRaPage(addr):
+		switch addr {
+		case 0x12: // RegIrqFlags. Write 1 to clear.
+			e.loraPage[0x12] &^= val
+		case 0x0F: // RegFifoRxBaseAddr.
+			e.loraPage[0x0F] = val
+			e.rxWritePtr = val
+		case 0x10, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x25, 0x28, 0x29, 0x2A, 0x2C:
+			// Read-only status registers.
+		default:
+			e.loraPage[addr] = val
+		}
+	case addr == 0x3F && !e.isLoRaPage(addr): // RegIrqFlags2. Setting FifoOverrun clears the FIFO.
+		if val&RF95W_FSK_IRQ2_FIFOOVERRUN != 0 {
+			e.fskFifo = nil
+			e.fskPage[0x3F] &^= RF95W_FSK_IRQ2_FIFOOVERRUN | RF95W_FSK_IRQ2_PAYLOADREADY | RF95W_FSK_IRQ2_CRCOK
+			e.fskPage[0x3E] &^= RF95W_FSK_IRQ1_SYNCADDRESSMATCH
+		}
+	case addr == 0x3B: // RegImageCal. The calibration completes immediately.
+		e.fskPage[0x3B] = val &^ 0x60
+	default:
+		*e.reg(addr) = val
+	}
+}
+
+/*
+	writeOpMode().
+	 LongRangeMode can only be changed while in SLEEP mode, by a write that also selects SLEEP. In all other cases
+	 writes to it are ignored (e.g. writing RF95W_MODE_STDBY keeps the module in LoRa mode).
+*/
+
+func (e *SX1276Emulator) writeOpMode(val byte) {
+	cur := e.regs[0x01]
+	if cur&0x07 != RF95W_MODE_SLEEP || val&0x07 != RF95W_MODE_SLEEP {
+		val = (val &^ RF95W_MODE_LORA) | (cur & RF95W_MODE_LORA)
+	}
+	if (cur^val)&RF95W_MODE_LORA != 0 {
+		// Switching modems clears the FIFO.
+		e.fifo = [256]byte{}
+		e.fskFifo = nil
+	}
+	e.regs[0x01] = val
+	e.enterMode(val & 0x07)
+}
+
+func (e *SX1276Emulator) setMode(mode byte) {
+	e.regs[0x01] = (e.regs[0x01] &^ 0x07) | mode
+}
+
+func (e *SX1276Emulator) enterMode(mode byte) {
+	if e.txTimer != nil && mode != RF95W_MODE_TX {
+		// Transmission aborted.
+		e.txTimer.Stop()
+		e.txTimer = nil
+	}
+	if !e.isLoRa() {
+		e.enterFSKMode(mode)
+		return
+	}
+	switch mode {
+	case RF95W_MODE_SLEEP:
+		e.rxWritePtr = e.loraPage[0x0F] // RegFifoRxBaseAddr.
+	case RF95W_MODE_CAD:
+		flags := byte(RF95W_IRQ_FLAG_CADDONE)
+		if e.Busy {
+			flags |= RF95W_IRQ_FLAG_CADDETECTED
+		}
+		e.setMode(RF95W_MODE_STDBY)
+		e.setIRQ(flags)
+	case RF95W_MODE_TX:
+		// Capture the packet from the FIFO when TX starts.
+		n := int(e.loraPage[0x22]) // RegPayloadLength.
+		base := e.loraPage[0x0E]   // RegFifoTxBaseAddr.
+		pkt := make([]byte, n)
+		for i := 0; i < n; i++ {
+			pkt[i] = e.fifo[base]
+			base++
+		}
+		e.startTX(pkt)
+	}
+}
+
+/*
+	enterFSKMode().
+	 FSK mode transitions. PacketSent is cleared when leaving TX, and the FIFO in SLEEP.
+*/
+
+func (e *SX1276Emulator) enterFSKMode(mode byte) {
+	if mode != RF95W_MODE_TX {
+		e.fskPage[0x3F] &^= RF95W_FSK_IRQ2_PACKETSENT
+	}
+	switch mode {
+	case RF95W_MODE_SLEEP:
+		e.fskFifo = nil
+	case RF95W_MODE_TX:
+		// Capture the packet from the FIFO: the length byte and payload, or PayloadLength bytes.
+		pkt := e.fskFifo
+		if e.fskPage[0x30]&0x80 != 0 { // RegPacketConfig1 PacketFormat variable.
+			if len(pkt) > 0 {
+				n := int(pkt[0])
+				pkt = pkt[1:]
+				if n < len(pkt) {
+					pkt = pkt[:n]
+				}
+			}
+		} else if n := int(e.fskPage[0x32]); n < len(pkt) { // RegPayloadLength.
+			pkt = pkt[:n]
+		}
+		e.fskFifo = nil
+		e.startTX(append([]byte(nil), pkt...))
+	}
+}
+
+/*
+	startTX().
+	 Completes the transmission after TxDelay.
+*/
+
+func (e *SX1276Emulator) startTX(pkt []byte) {
+	if e.TxDelay == 0 {
+		e.finishTX(pkt)
+		return
+	}
+	e.txTimer = time.AfterFunc(e.TxDelay, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.txTimer == nil || e.closed {
+			return
+		}
+		e.txTimer = nil
+		e.finishTX(pkt)
+	})
+}
+
+func (e *SX1276Emulator) finishTX(pkt []byte) {
+	e.transmitted = append(e.transmitted, pkt)
+	if !e.isLoRa() {
+		// The module stays in TX until it is switched to another mode.
+		e.fskPage[0x3F] |= RF95W_FSK_IRQ2_PACKETSENT
+		if e.dioMapping(0) == RF95W_FSK_DIO0_PACKETSENT {
+			e.raise(0)
+		}
+		return
+	}
+	e.setMode(RF95W_MODE_STDBY)
+	e.setIRQ(RF95W_IRQ_FLAG_TXDONE)
+}
+
+// LoRa IRQ signalled on each DIO line, per mapping value.
+var emulatorDIOFlags = [6][4]byte{
+	{RF95W_IRQ_FLAG_RXDONE, RF95W_IRQ_FLAG_TXDONE, RF95W_IRQ_FLAG_CADDONE, 0},
+	{RF95W_IRQ_FLAG_RXTIMEOUT, RF95W_IRQ_FLAG_FHSSCHANGECHANNEL, RF95W_IRQ_FLAG_CADDETECTED, 0},
+	{RF95W_IRQ_FLAG_FHSSCHANGECHANNEL, RF95W_IRQ_FLAG_FHSSCHANGECHANNEL, RF95W_IRQ_FLAG_FHSSCHANGECHANNEL, 0},
+	{RF95W_IRQ_FLAG_CADDONE, RF95W_IRQ_FLAG_VALIDHEADER, RF95W_IRQ_FLAG_PAYLOADCRCERROR, 0},
+	{RF95W_IRQ_FLAG_CADDETECTED, 0, 0, 0}, // PllLock is not modelled.
+	{0, 0, 0, 0},                          // ModeReady, ClkOut are not modelled.
+}
+
+/*
+	setIRQ().
+	 Sets IRQ flags in RegIrqFlags, except the ones masked in RegIrqFlagsMask, and raises the DIO lines mapped to them.
+*/
+
+func (e *SX1276Emulator) setIRQ(flags byte) {
+	flags &^= e.loraPage[0x11]
+	e.loraPage[0x12] |= flags
+	for line := range e.dio {
+		if emulatorDIOFlags[line][e.dioMapping(line)]&flags != 0 {
+			e.raise(line)
+		}
+	}
+}
+
+/*
+	dioMapping().
+	 Returns the 2-bit mapping of a DIO line from RegDioMapping1/2.
+*/
+
+func (e *SX1276Emulator) dioMapping(line int) byte {
+	if line < 4 {
+		return (e.regs[0x40] >> uint(6-2*line)) & 0x03
+	}
+	return (e.regs[0x41] >> uint(6-2*(line-4))) & 0x03
+}
+
+/*
+	raise().
+	 Signals a rising edge on a DIO line. Edges are dropped if nobody is listening.
+*/
+
+func (e *SX1276Emulator) raise(line int) {
+	select {
+	case e.dio[line] <- GPIOEvent{Pin: line, Time: time.Now()}:
+	default:
+	}
+}
@@ -0,0 +1,335 @@
+// Frequency bands, module variants, image calibration and crystal offset correction.
+
+package goRFM95W
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Module variants, for RFM95W_Options.Variant.
+const (
+	RF95W_VARIANT_RFM95 = 0 // 868/915 MHz.
+	RF95W_VARIANT_RFM96 = 1 // 433/470 MHz.
+	RF95W_VARIANT_RFM97 = 2 // 868/915 MHz, SF6-SF9.
+	RF95W_VARIANT_RFM98 = 3 // 433/470 MHz.
+)
+
+const (
+	RF95W_FXOSC = 32000000 // Hz. Crystal oscillator.
+
+	RF95W_LF_MAX_FREQ = 779000000 // Hz. Bands 2 and 3 (LF port) are below this, band 1 (HF port) above.
+
+	RF95W_HIGHBWOPTIMIZE1_500KHZ = 0x02 // Errata 2.1: receiver spurious reception at 500 kHz bandwidth.
+	RF95W_HIGHBWOPTIMIZE1_OTHER  = 0x03
+	RF95W_HIGHBWOPTIMIZE2_HF     = 0x64
+	RF95W_HIGHBWOPTIMIZE2_LF     = 0x7F
+
+	RF95W_IMAGECAL_DELTA   = 10000000 // Hz. Recalibrate when the frequency moves further than this.
+	RF95W_IMAGECAL_TIMEOUT = 100 * time.Millisecond
+
+	RF95W_AFC_WEIGHT  = 0.25 // Weight of each received packet in the averaged frequency offset.
+	RF95W_AFC_MAX_PPM = 100  // Limit of the crystal offset correction.
+)
+
+/*
+	RFM95W_Variant.
+	 Frequency range and spreading factors supported by a module variant.
+*/
+
+type RFM95W_Variant struct {
+	Name             string
+	MinFrequency     uint64 // Hz.
+	MaxFrequency     uint64 // Hz.
+	DefaultFrequency uint64 // Hz. Used by New() without parameters.
+	MinSF            int
+	MaxSF            int
+}
+
+var RFM95W_Variants = map[int]RFM95W_Variant{
+	RF95W_VARIANT_RFM95: {"RFM95W", 862000000, 1020000000, RF95W_DEFAULT_FREQ, 6, 12},
+	RF95W_VARIANT_RFM96: {"RFM96W", 410000000, 525000000, 433000000, 6, 12},
+	RF95W_VARIANT_RFM97: {"RFM97W", 862000000, 1020000000, RF95W_DEFAULT_FREQ, 6, 9},
+	RF95W_VARIANT_RFM98: {"RFM98W", 410000000, 525000000, 433000000, 6, 12},
+}
+
+/*
+	checkFrequency().
+	 Checks that the module variant can use the frequency.
+*/
+
+func checkFrequency(variant int, freq uint64) error {
+	v := RFM95W_Variants[variant]
+	if freq < v.MinFrequency || freq > v.MaxFrequency {
+		return fmt.Errorf("Invalid frequency requested, %s supports %d-%d Hz.", v.Name, v.MinFrequency, v.MaxFrequency)
+	}
+	return nil
+}
+
+/*
+	SetFrequency().
+	 Sets the carrier frequency (Hz), within the range of the module variant. Selects the LF or HF band settings
+	 and runs image calibration if the frequency moved by more than RF95W_IMAGECAL_DELTA since the last one.
+*/
+
+func (r *RFM95W) SetFrequency(freq uint64) error {
+	err := checkFrequency(r.variant, freq)
+	if err != nil {
+		return err
+	}
+	err = r.setFrf(freq)
+	if err != nil {
+		return err
+	}
+	r.settings.Frequency = freq
+
+	lowFrequency := freq < RF95W_LF_MAX_FREQ
+	if lowFrequency != r.lowFrequency {
+		// Switch LowFrequencyModeOn, staying in the same mode.
+		r.lowFrequency = lowFrequency
+		err = r.SetMode(r.currentMode)
+		if err != nil {
+			return err
+		}
+	}
+	err = r.setHighBWOptimize()
+	if err != nil {
+		return err
+	}
+
+	delta := int64(freq) - int64(r.imageCalFreq)
+	if r.imageCalFreq == 0 || delta > RF95W_IMAGECAL_DELTA || delta < -RF95W_IMAGECAL_DELTA {
+		return r.CalibrateImage()
+	}
+	return nil
+}
+
+/*
+	setFrf().
+	 Programs the carrier frequency registers, corrected for the crystal offset. Frf = freq * 2^19 / FXOSC, rounded to
+	 the nearest step (~61 Hz).
+*/
+
+func (r *RFM95W) setFrf(freq uint64) error {
+	ppm := r.FrequencyCorrection()
+	freq = uint64(math.Floor(float64(freq)*(1+ppm/1e6) + 0.5))
+	steps := uint32(((freq << 19) + RF95W_FXOSC/2) / RF95W_FXOSC)
+	r.SetRegister(RF95W_REG_FRFMSB, byte(steps>>16))
+	r.SetRegister(RF95W_REG_FRFMID, byte((steps>>8)&0xFF))
+	_, err := r.SetRegister(RF95W_REG_FRFLSB, byte(steps&0xFF))
+	return err
+}
+
+/*
+	setHighBWOptimize().
+	 Receiver settings for 500 kHz bandwidth, which depend on the band (SX1276 errata 2.1). LoRa only.
+*/
+
+func (r *RFM95W) setHighBWOptimize() error {
+	if !r.isLoRa() {
+		return nil
+	}
+	if r.settings.Bandwidth != 500000 {
+		_, err := r.SetRegister(RF95W_REG_HIGHBWOPTIMIZE1, RF95W_HIGHBWOPTIMIZE1_OTHER)
+		return err
+	}
+	_, err := r.SetRegister(RF95W_REG_HIGHBWOPTIMIZE1, RF95W_HIGHBWOPTIMIZE1_500KHZ)
+	if err != nil {
+		return err
+	}
+	val := byte(RF95W_HIGHBWOPTIMIZE2_HF)
+	if r.lowFrequency {
+		val = RF95W_HIGHBWOPTIMIZE2_LF
+	}
+	_, err = r.SetRegister(RF95W_REG_HIGHBWOPTIMIZE2, val)
+	return err
+}
+
+/*
+	CalibrateImage().
+	 Runs the receiver image and RSSI calibration at the current frequency and waits for it to finish. The module
+	 only calibrates automatically at power on, at 434 MHz.
+*/
+
+func (r *RFM95W) CalibrateImage() error {
+	return r.inFSKStandby(r.calibrateImage)
+}
+
+/*
+	calibrateImage().
+	 Runs the image calibration, in FSK STDBY mode. Records the frequency and temperature it was done at.
+*/
+
+func (r *RFM95W) calibrateImage() error {
+	err := r.SetFlag(RF95W_FIELD_IMAGECALSTART, true)
+	if err != nil {
+		return err
+	}
+	timeout := time.Now().Add(RF95W_IMAGECAL_TIMEOUT)
+	for {
+		running, err := r.GetFlag(RF95W_FIELD_IMAGECALRUNNING)
+		if err != nil {
+			return err
+		}
+		if !running {
+			break
+		}
+		if time.Now().After(timeout) {
+			return errors.New("CalibrateImage(): timed out.")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	r.imageCalFreq = r.settings.Frequency
+	r.imageCalTemp, err = r.measureTemperature()
+	return err
+}
+
+/*
+	inFSKStandby().
+	 Runs f with the module in FSK STDBY mode, which is needed for image calibration and the temperature sensor.
+	 In LoRa mode, the modem is switched through SLEEP. Afterwards the module goes back to STDBY, or RXCONTINUOUS
+	 if it was receiving.
+*/
+
+func (r *RFM95W) inFSKStandby(f func() error) error {
+	prevMode := r.currentMode
+	loRa := r.isLoRa()
+	if loRa {
+		// LoRa SLEEP -> FSK SLEEP.
+		err := r.setModem(RF95W_MODE_FSK)
+		if err != nil {
+			return err
+		}
+	}
+	err := r.SetMode(RF95W_MODE_STDBY)
+	if err != nil {
+		return err
+	}
+
+	ferr := f()
+
+	if loRa {
+		// FSK SLEEP -> LoRa SLEEP.
+		err = r.setModem(RF95W_MODE_LORA)
+		if err != nil {
+			return err
+		}
+	}
+	err = r.SetMode(RF95W_MODE_STDBY)
+	if err != nil {
+		return err
+	}
+	if prevMode == RF95W_MODE_RXCONTINUOUS {
+		err := r.setRXMode()
+		if err != nil {
+			return err
+		}
+	}
+	return ferr
+}
+
+/*
+	readFrequencyError().
+	 Reads the frequency error (Hz) of the last received packet from RegFei. Positive if the transmitter is above the
+	 programmed frequency.
+*/
+
+func (r *RFM95W) readFrequencyError() (int, error) {
+	b, err := r.GetBytes(RF95W_REG_FEIMSB, 3)
+	if err != nil {
+		return 0, err
+	}
+	// 20 bit two's complement.
+	fei := int32(b[0]&0x0F)<<16 | int32(b[1])<<8 | int32(b[2])
+	if fei&0x80000 != 0 {
+		fei -= 0x100000
+	}
+	// FreqError = FEI * 2^24 / FXOSC * BW / 500 kHz.
+	return int(math.Floor(float64(fei)*(1<<24)/RF95W_FXOSC*float64(r.settings.Bandwidth)/500000 + 0.5)), nil
+}
+
+/*
+	FrequencyCorrection().
+	 Returns the crystal offset correction (ppm). With AFC enabled this is updated from each received packet, and it
+	 can be saved and passed back in RFM95W_Options.FrequencyCorrection.
+*/
+
+func (r *RFM95W) FrequencyCorrection() float64 {
+	r.mu_AFC.Lock()
+	defer r.mu_AFC.Unlock()
+	return r.ppmCorrection
+}
+
+/*
+	SetFrequencyCorrection().
+	 Sets the crystal offset correction (ppm), applied to the carrier frequency and, in LoRa mode,
+	 RegPpmCorrection. Replaces a correction from AFC that hasn't been applied yet. Runs through queueHandler,
+	 like SetParams().
+*/
+
+func (r *RFM95W) SetFrequencyCorrection(ppm float64) error {
+	if ppm < -RF95W_AFC_MAX_PPM || ppm > RF95W_AFC_MAX_PPM {
+		return errors.New("Invalid frequency correction requested.")
+	}
+	return r.runJob(func() error {
+		r.afcPending = false
+		err := r.SetMode(RF95W_MODE_STDBY)
+		if err != nil {
+			return err
+		}
+		return r.setFrequencyCorrection(ppm)
+	})
+}
+
+/*
+	setFrequencyCorrection().
+	 Writes the correction without touching a pending AFC correction. Called from queueHandler or a job.
+*/
+
+func (r *RFM95W) setFrequencyCorrection(ppm float64) error {
+	r.mu_AFC.Lock()
+	r.ppmCorrection = ppm
+	r.mu_AFC.Unlock()
+	err := r.setFrf(r.settings.Frequency)
+	if err != nil || !r.isLoRa() {
+		return err
+	}
+	_, err = r.SetRegister(RF95W_REG_PPMCORRECTION, byte(int8(math.Floor(ppm+0.5))))
+	return err
+}
+
+/*
+	trackFrequencyError().
+	 AFC. Moves the crystal offset correction towards the frequency error of a received packet, averaged over
+	 packets with RF95W_AFC_WEIGHT. Rewriting RegFrf in RXCONTINUOUS could disturb a reception, so the correction
+	 is only applied by applyFrequencyCorrection() once queueHandler has the radio free.
+*/
+
+func (r *RFM95W) trackFrequencyError(hz int) {
+	ppm := r.ppmCorrection
+	if r.afcPending {
+		ppm = r.afcCorrection
+	}
+	ppm += RF95W_AFC_WEIGHT * float64(hz) / float64(r.settings.Frequency) * 1e6
+	ppm = math.Max(-RF95W_AFC_MAX_PPM, math.Min(RF95W_AFC_MAX_PPM, ppm))
+	if r.Debug {
+		fmt.Printf("trackFrequencyError(): error %d Hz, correction %.2f ppm.\n", hz, ppm)
+	}
+	r.afcCorrection, r.afcPending = ppm, true
+}
+
+/*
+	applyFrequencyCorrection().
+	 Applies the correction from trackFrequencyError() in STDBY. The caller restarts RX or TX.
+*/
+
+func (r *RFM95W) applyFrequencyCorrection() error {
+	r.afcPending = false
+	err := r.SetMode(RF95W_MODE_STDBY)
+	if err != nil {
+		return err
+	}
+	return r.setFrequencyCorrection(r.afcCorrection)
+}
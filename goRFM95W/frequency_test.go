@@ -0,0 +1,134 @@
+package goRFM95W
+
+import (
+	"testing"
+	"time"
+)
+
+// frf returns the frequency programmed in RegFrf.
+func frf(e *SX1276Emulator) uint32 {
+	return uint32(e.Register(RF95W_REG_FRFMSB))<<16 | uint32(e.Register(RF95W_REG_FRFMID))<<8 | uint32(e.Register(RF95W_REG_FRFLSB))
+}
+
+func TestSetFrequency(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	if err := r.SetFrequency(915000000); err != nil {
+		t.Fatal(err)
+	}
+	if v := frf(e); v != 0xE4C000 {
+		t.Fatalf("RegFrf %06x, expected e4c000.", v)
+	}
+	if e.Register(RF95W_REG_OPMODE)&RF95W_MODE_LF != 0 {
+		t.Fatal("LowFrequencyModeOn set at 915 MHz.")
+	}
+	if err := r.SetFrequency(433000000); err == nil {
+		t.Fatal("433 MHz accepted on an RFM95W.")
+	}
+	// Moving more than RF95W_IMAGECAL_DELTA away repeats the image calibration.
+	if err := r.SetFrequency(868000000); err != nil {
+		t.Fatal(err)
+	}
+	if r.imageCalFreq != 868000000 {
+		t.Fatalf("Image calibrated at %d Hz, expected 868 MHz.", r.imageCalFreq)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	e := NewSX1276Emulator()
+	pins := RF95W_EMULATOR_PINS
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins, SettleTime: time.Millisecond, Variant: RF95W_VARIANT_RFM96})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Defaults to 433 MHz, in the low frequency band.
+	if v := frf(e); v != 0x6C4000 {
+		t.Fatalf("RegFrf %06x, expected 6c4000.", v)
+	}
+	if e.Register(RF95W_REG_OPMODE)&RF95W_MODE_LF == 0 {
+		t.Fatal("LowFrequencyModeOn not set at 433 MHz.")
+	}
+	if r.imageCalFreq != 433000000 {
+		t.Fatalf("Image calibrated at %d Hz, expected 433 MHz.", r.imageCalFreq)
+	}
+	r.Close()
+
+	if _, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins, Variant: 9}); err == nil {
+		t.Fatal("Variant 9 accepted.")
+	}
+
+	e = NewSX1276Emulator()
+	r, err = New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins, SettleTime: time.Millisecond, Variant: RF95W_VARIANT_RFM97})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.SetSpreadingFactor(10); err == nil {
+		t.Fatal("SF10 accepted on an RFM97W.")
+	}
+}
+
+func TestAFC(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	p := r.settings
+	p.AFC = true
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	startReceiving(t, r, e)
+	// A transmitter 10 ppm low: the frequency error shrinks as the correction follows it.
+	var msgs []RFM95W_Message
+	for i := 0; i < 20; i++ {
+		fe := -9150 - int(r.FrequencyCorrection()*915)
+		if err := e.Receive(EmulatorPacket{Payload: []byte("abc"), FrequencyError: fe}); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, waitReceived(t, r, 1)...)
+		waitFor(t, "RXCONTINUOUS", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+	}
+	if d := msgs[0].FrequencyError + 9150; d < -300 || d > 300 {
+		t.Fatalf("First FrequencyError %d Hz, expected about -9150 Hz.", msgs[0].FrequencyError)
+	}
+	if c := r.FrequencyCorrection(); c > -9 || c < -10.5 {
+		t.Fatalf("Correction %.2f ppm, expected about -10 ppm.", c)
+	}
+	if v := frf(e); v == 0xE4C000 {
+		t.Fatal("RegFrf not corrected.")
+	}
+}
+
+func TestAFCDeferred(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	before := frf(e)
+	// Tracking only records the correction.
+	r.trackFrequencyError(9150)
+	if frf(e) != before || r.FrequencyCorrection() != 0 || !r.afcPending {
+		t.Fatalf("RegFrf %06x, correction %.2f ppm, pending %t.", frf(e), r.FrequencyCorrection(), r.afcPending)
+	}
+	if err := r.applyFrequencyCorrection(); err != nil {
+		t.Fatal(err)
+	}
+	if frf(e) == before || r.FrequencyCorrection() <= 0 || r.afcPending {
+		t.Fatalf("RegFrf %06x, correction %.2f ppm, pending %t.", frf(e), r.FrequencyCorrection(), r.afcPending)
+	}
+	if e.Mode() != RF95W_MODE_LORA|RF95W_MODE_STDBY {
+		t.Fatalf("RegOpMode %02x, expected STDBY.", e.Mode())
+	}
+}
+
+func TestAFCPendingKept(t *testing.T) {
+	r, _ := newTestModule(t, nil)
+	r.trackFrequencyError(9150)
+	// Generating random bytes restores the settings, without dropping the AFC correction.
+	if _, err := r.RandomReader().Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if !r.afcPending {
+		t.Fatal("Pending correction dropped.")
+	}
+	if err := r.SetFrequencyCorrection(2); err != nil {
+		t.Fatal(err)
+	}
+	if r.afcPending || r.FrequencyCorrection() != 2 {
+		t.Fatalf("Correction %.2f ppm, pending %t.", r.FrequencyCorrection(), r.afcPending)
+	}
+}
@@ -0,0 +1,245 @@
+// Linux GPIO character device (/dev/gpiochipN) backend.
+
+package goRFM95W
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// GPIO v2 uAPI, from linux/gpio.h.
+const (
+	gpioV2LinesMax      = 64
+	gpioMaxNameSize     = 32
+	gpioV2LineConfigLen = 272 // struct gpio_v2_line_config.
+	gpioV2LineReqLen    = 592 // struct gpio_v2_line_request.
+	gpioV2LineEventLen  = 48  // struct gpio_v2_line_event.
+
+	gpioV2GetLineIoctl       = 0xC250B407 // _IOWR(0xB4, 0x07, struct gpio_v2_line_request)
+	gpioV2LineSetValuesIoctl = 0xC010B40F // _IOWR(0xB4, 0x0F, struct gpio_v2_line_values)
+
+	gpioV2LineFlagInput         = 1 << 2
+	gpioV2LineFlagOutput        = 1 << 3
+	gpioV2LineFlagEdgeRising    = 1 << 4
+	gpioV2LineFlagClockRealtime = 1 << 11
+
+	gpioV2LineEventRisingEdge = 1
+)
+
+// Default wiring (RPi interface board) in BCM GPIO numbering, for use with GPIOChip on /dev/gpiochip0.
+var RF95W_DEFAULT_GPIOCHIP_PINS = RFM95W_Pins{
+	CS:   OptionalPin(8),  // CE0.
+	DIO0: OptionalPin(25), // WiringPi GPIO 6.
+	ACT:  OptionalPin(7),  // CE1.
+}
+
+/*
+	GPIOChip.
+	 GPIO implementation using the Linux GPIO character device interface (kernel 5.10 and later). Pins are line
+	 offsets on the chip, which on the Raspberry Pi is BCM GPIO numbering. Interrupt events carry the kernel
+	 timestamp of the edge.
+*/
+
+type GPIOChip struct {
+	chip  *os.File
+	mu    *sync.Mutex
+	lines map[int]*os.File // Line request per pin.
+	// Set if the kernel does not support CLOCK_REALTIME event timestamps, which are then CLOCK_MONOTONIC.
+	monotonic bool
+}
+
+/*
+	OpenGPIOChip().
+	 Opens a GPIO chip, e.g. "/dev/gpiochip0".
+*/
+
+func OpenGPIOChip(dev string) (*GPIOChip, error) {
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &GPIOChip{
+		chip:  f,
+		mu:    &sync.Mutex{},
+		lines: make(map[int]*os.File),
+	}, nil
+}
+
+/*
+	Close().
+	 Releases all lines and closes the chip. Interrupt channels are closed.
+*/
+
+func (g *GPIOChip) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for pin, f := range g.lines {
+		f.Close()
+		delete(g.lines, pin)
+	}
+	return g.chip.Close()
+}
+
+func (g *GPIOChip) SetOutput(pin int) error {
+	_, err := g.request(pin, gpioV2LineFlagOutput)
+	return err
+}
+
+func (g *GPIOChip) SetInput(pin int) error {
+	_, err := g.request(pin, gpioV2LineFlagInput)
+	return err
+}
+
+func (g *GPIOChip) Write(pin int, high bool) error {
+	g.mu.Lock()
+	f, ok := g.lines[pin]
+	g.mu.Unlock()
+	if !ok {
+		return errors.New("GPIOChip: line not set up as output.")
+	}
+
+	// struct gpio_v2_line_values.
+	var values [16]byte
+	if high {
+		binary.LittleEndian.PutUint64(values[0:], 1) // bits.
+	}
+	binary.LittleEndian.PutUint64(values[8:], 1) // mask.
+	return ioctl(f.Fd(), gpioV2LineSetValuesIoctl, values[:])
+}
+
+func (g *GPIOChip) Interrupt(pin int) (<-chan GPIOEvent, error) {
+	f, err := g.request(pin, gpioV2LineFlagInput|gpioV2LineFlagEdgeRising)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(chan GPIOEvent, 16)
+	go g.readEvents(pin, f, ret)
+	return ret, nil
+}
+
+/*
+	request().
+	 Requests a single line with the given flags, replacing any previous request for the same pin.
+*/
+
+func (g *GPIOChip) request(pin int, flags uint64) (*os.File, error) {
+	if pin < 0 {
+		return nil, errors.New("GPIOChip: invalid pin.")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.lines[pin]; ok {
+		f.Close()
+		delete(g.lines, pin)
+	}
+
+	if flags&gpioV2LineFlagEdgeRising != 0 && !g.monotonic {
+		fd, err := g.getLine(pin, flags|gpioV2LineFlagClockRealtime)
+		if err == nil {
+			return g.addLine(pin, fd), nil
+		}
+		if err != syscall.EINVAL {
+			return nil, err
+		}
+		// Kernel older than 5.11, no realtime timestamps.
+		g.monotonic = true
+	}
+	fd, err := g.getLine(pin, flags)
+	if err != nil {
+		return nil, err
+	}
+	return g.addLine(pin, fd), nil
+}
+
+func (g *GPIOChip) addLine(pin int, fd int) *os.File {
+	// Non-blocking, so that the runtime poller is used and Close() wakes up readEvents().
+	syscall.SetNonblock(fd, true)
+	f := os.NewFile(uintptr(fd), "gpio-line")
+	g.lines[pin] = f
+	return f
+}
+
+/*
+	getLine().
+	 GPIO_V2_GET_LINE_IOCTL. Builds struct gpio_v2_line_request by hand so that the layout does not depend on
+	 the alignment of uint64 on the host architecture.
+*/
+
+func (g *GPIOChip) getLine(pin int, flags uint64) (int, error) {
+	var req [gpioV2LineReqLen]byte
+	le := binary.LittleEndian
+
+	le.PutUint32(req[0:], uint32(pin)) // offsets[0].
+	consumerOff := 4 * gpioV2LinesMax
+	copy(req[consumerOff:consumerOff+gpioMaxNameSize-1], "goRFM95W")
+	configOff := consumerOff + gpioMaxNameSize
+	le.PutUint64(req[configOff:], flags) // config.flags.
+	numLinesOff := configOff + gpioV2LineConfigLen
+	le.PutUint32(req[numLinesOff:], 1) // num_lines.
+	fdOff := gpioV2LineReqLen - 4
+
+	if err := ioctl(g.chip.Fd(), gpioV2GetLineIoctl, req[:]); err != nil {
+		return -1, err
+	}
+	return int(int32(le.Uint32(req[fdOff:]))), nil
+}
+
+/*
+	readEvents().
+	 Reads edge events from a line until it is released, and forwards them with their timestamps.
+*/
+
+func (g *GPIOChip) readEvents(pin int, f *os.File, c chan<- GPIOEvent) {
+	defer close(c)
+	buf := make([]byte, 16*gpioV2LineEventLen)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return
+		}
+		for i := 0; i+gpioV2LineEventLen <= n; i += gpioV2LineEventLen {
+			ev := buf[i : i+gpioV2LineEventLen]
+			if binary.LittleEndian.Uint32(ev[8:]) != gpioV2LineEventRisingEdge { // id.
+				continue
+			}
+			c <- GPIOEvent{Pin: pin, Time: g.eventTime(binary.LittleEndian.Uint64(ev[0:]))}
+		}
+	}
+}
+
+/*
+	eventTime().
+	 Converts an event timestamp to wall clock time.
+*/
+
+func (g *GPIOChip) eventTime(ns uint64) time.Time {
+	g.mu.Lock()
+	monotonic := g.monotonic
+	g.mu.Unlock()
+
+	if !monotonic {
+		return time.Unix(0, int64(ns))
+	}
+	var ts syscall.Timespec
+	_, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, 1, uintptr(unsafe.Pointer(&ts)), 0) // CLOCK_MONOTONIC.
+	now := time.Now()
+	if errno != 0 {
+		return now
+	}
+	return now.Add(-time.Duration(ts.Nano() - int64(ns)))
+}
+
+func ioctl(fd uintptr, req uintptr, arg []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(&arg[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -1,46 +1,105 @@
 package goRFM95W
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"github.com/cyoung/rpi"
-	"golang.org/x/exp/io/spi"
 	"sync"
 	"time"
 )
 
 type RFM95W_Params struct {
-	TransmitMode    int
+	// RF95W_TRANSMIT_LORA (default), RF95W_TRANSMIT_FSK or RF95W_TRANSMIT_OOK.
+	TransmitMode    RFM95W_TransmitMode
 	Frequency       uint64 // Hz.
-	Bandwidth       int    // Hz.
+	Bandwidth       int    // Hz. FSK/OOK: receiver bandwidth (RFM95W_FSKBandwidths), 0 selects it from DataRate and FrequencyDeviation.
 	SpreadingFactor int    // LoRa specific.
 	CodingRate      int    // LoRa specific.
-	PreambleLength  int    // LoRa specific.
-	DataRate        int    // FSK specific.
+	PreambleLength  int    // Symbols. FSK/OOK: bytes, 0 selects RF95W_FSK_DEFAULT_PREAMBLE.
+	DataRate        int    // FSK/OOK specific. bit/s, 0 selects RF95W_FSK_DEFAULT_BITRATE.
+	TXPower         int    // dBm. 0 selects RF95W_DEFAULT_TXPOWER (+15 dBm on RFO).
+	HeaderMode      int    // RF95W_HEADER_EXPLICIT (default) or RF95W_HEADER_IMPLICIT. SF6 is always implicit. FSK/OOK: implicit is fixed length.
+	PayloadLength   int    // Fixed payload length in implicit header mode. FSK/OOK: 1-64 (RF95W_FSK_FIFO_SIZE).
+	// Add a payload CRC when transmitting. LoRa: when receiving, the CRC is checked if the explicit header says that
+	// there is one, or in implicit header mode if this is set.
+	CRC bool
+	// LoRa specific. RF95W_SETTING_AUTO (default): on when the symbol time is over 16 ms. Or RF95W_SETTING_ON/OFF.
+	LowDataRateOptimize int
+	AGC                 int  // LoRa specific. RF95W_SETTING_AUTO (default) or RF95W_SETTING_ON: LNA gain set by the AGC.
+	SyncWord            int  // LoRa specific. RF95W_SYNCWORD_PRIVATE (default, 0), RF95W_SYNCWORD_LORAWAN or another value.
+	InvertIQTX          bool // LoRa specific. Transmit with inverted I and Q (e.g. gateway downlinks).
+	InvertIQRX          bool // LoRa specific. Receive with inverted I and Q.
+	AFC                 bool // LoRa specific. Correct the crystal offset from the frequency error of received packets.
+	// FSK specific. Hz, 0 selects RF95W_FSK_DEFAULT_FDEV. FrequencyDeviation + DataRate/2 must be at most 250 kHz.
+	FrequencyDeviation int
+	Shaping            int    // FSK/OOK specific. Data shaping, RF95W_SHAPING_* (FSK) or RF95W_SHAPING_OOK_* (OOK).
+	FSKSyncWord        []byte // FSK/OOK specific. 1-8 bytes, no 0x00 bytes. Empty selects RF95W_FSK_DEFAULT_SYNCWORD.
+	Whitening          bool   // FSK/OOK specific. Data whitening, for long runs of 0 or 1 bits.
+	AddressFiltering   int    // FSK/OOK specific. RF95W_ADDRESS_FILTER_*. The address is the first payload byte.
+	NodeAddress        byte   // FSK/OOK specific.
+	BroadcastAddress   byte   // FSK/OOK specific.
+	OOKThreshold       int    // OOK specific. Data slicer threshold, RF95W_OOK_THRESHOLD_PEAK (default), _FIXED or _AVERAGE.
+	// OOK specific. dB. The fixed threshold, or the threshold floor in peak mode. 0 selects RF95W_OOK_DEFAULT_FIXED.
+	OOKFixedThreshold int
 }
 
 type RFM95W_Message struct {
-	Buf      []byte
-	RSSI     int     // dBm
-	SNR      float64 // dB
-	Received time.Time
-	Params   RFM95W_Params
+	Buf        []byte
+	RSSI       int     // dBm. Packet RSSI, signal and noise.
+	SignalRSSI float64 // dBm. Strength of the LoRa signal, which can be below the noise floor.
+	SNR        float64 // dB. LoRa only.
+	Received   time.Time
+	Params     RFM95W_Params
+	// From the explicit header. Zero in implicit header mode.
+	CodingRate int  // Coding rate used by the transmitter, 5-8.
+	CRCPresent bool // The transmitter added a payload CRC.
+	// False if the payload CRC check failed. Such packets are only delivered with DeliverCRCErrors.
+	CRCValid       bool
+	FrequencyError int // Hz. Estimated offset of the transmitter from our (corrected) frequency.
 }
 
 type RFM95W struct {
 	Debug         bool // Print debug messages
-	SPI           *spi.Device
-	mode          int
+	ChipVersion   byte // RegVersion of the detected chip. Full revision in bits 7-4, metal mask revision in bits 3-0.
+	SPI           SPIBus
+	bus           *sharedBus  // Lock shared with other modules on the same SPI bus.
+	busKey        interface{} // Device path or SPIBus, see claimBus().
+	busClaimed    bool
+	ownBus        bool // SPI was opened by New().
+	GPIO          GPIO
+	Pins          RFM95W_Pins
+	useRFO        bool
+	variant       int
+	lowFrequency  bool   // LF band (LowFrequencyModeOn).
+	imageCalFreq  uint64 // Frequency of the last image calibration.
+	imageCalTemp  int    // Uncalibrated temperature of the last image calibration.
+	ppmCorrection float64
+	mu_AFC        *sync.Mutex // Guards ppmCorrection for FrequencyCorrection().
+	afcCorrection float64     // ppm. From trackFrequencyError(), waiting for applyFrequencyCorrection().
+	afcPending    bool
+	mode          int // Modem, RF95W_MODE_LORA, RF95W_MODE_FSK or RF95W_MODE_OOK. Set by init().
+	// Parameters in effect. The setters only update them when the register write succeeds.
 	settings      RFM95W_Params
-	interruptChan chan int
+	interruptChan chan dioEvent
+	dioMapping    RFM95W_DIOMapping
 	mu_Recv       *sync.Mutex
 	RecvBuf       []RFM95W_Message // This is constantly being filled up as messages are received.
 	txQueue       chan []byte
 	mu_Send       *sync.Mutex
 	currentMode   byte
+	polling       bool // Read RegIrqFlags on a timer instead of waiting for DIO0 interrupts.
 	stopQueue     chan int
+	jobQueue      chan *queueJob
+	jobWaiting    []*queueJob // Jobs waiting for the current operation to finish.
+	rxOngoing     bool        // ValidHeader seen, waiting for RxDone.
+	syncRSSI      int         // FSK/OOK: dBm, sampled on SyncAddressMatch.
+	syncRSSIValid bool
+	mu_Queue      *sync.Mutex   // Guards queueRunning and queueDone.
+	queueRunning  bool          // Between Start() and the exit of queueHandler.
+	queueDone     chan struct{} // Closed when queueHandler exits.
+	// Put packets that failed the payload CRC check in RecvBuf (with CRCValid false) instead of discarding them.
+	DeliverCRCErrors bool
+	// °C. Calibration offset added to the sensor reading in ReadTemperature().
+	TemperatureOffset int
 	// Temp variables for stats.
 	txStart    time.Time
 	LastTXTime time.Duration
@@ -48,160 +107,484 @@ type RFM95W struct {
 
 // Default settings.
 const (
-	RF95W_DEFAULT_FREQ = 915000000 // Hz
-	RF95W_DEFAULT_BW   = 500000    // Hz
-	RF95W_DEFAULT_SF   = 11
-	RF95W_DEFAULT_CR   = 5
-	RF95W_DEFAULT_PR   = 8
+	RF95W_DEFAULT_FREQ    = 915000000 // Hz
+	RF95W_DEFAULT_BW      = 500000    // Hz
+	RF95W_DEFAULT_SF      = 11
+	RF95W_DEFAULT_CR      = 5
+	RF95W_DEFAULT_PR      = 8
+	RF95W_DEFAULT_TXPOWER = 17 // dBm
 
-	// Hardware config.
-	RF95W_CS_PIN       = rpi.PIN_CE0
-	RF95W_DIO0_INT_PIN = rpi.PIN_GPIO_6
-	RF95W_ACT_PIN      = rpi.PIN_CE1
+	RF95W_SETTLE_TIME = 100 * time.Millisecond
+
+	// Polling mode interval limits.
+	RF95W_POLL_MIN = 1 * time.Millisecond
+	RF95W_POLL_MAX = 20 * time.Millisecond
 
 	SPI_WRITE_MASK = 0x80
+
+	RF95W_CHIP_VERSION = 0x12 // SX1276 RegVersion.
 )
 
-func New(params *RFM95W_Params) (*RFM95W, error) {
+/*
+	RFM95W_Options.
+	 Hardware options for New(). Zero values select the defaults.
+*/
+
+type RFM95W_Options struct {
+	SPI        SPIBus        // SPI transport. If nil, DevicePath is opened.
+	DevicePath string        // SPI device. Default RF95W_SPI_DEV.
+	SPISpeed   int64         // Hz. Default RF95W_SPI_SPEED.
+	SPIMode    int           // SPI mode, 0-3. Default 0.
+	GPIO       GPIO          // GPIO backend. Default WiringPi.
+	Pins       *RFM95W_Pins  // Pin map. Default RF95W_DEFAULT_PINS.
+	SettleTime time.Duration // Wait before talking to the module. Default RF95W_SETTLE_TIME.
+	Polling    bool          // Poll RegIrqFlags instead of using the DIO0 interrupt. Implied if Pins.DIO0 is not connected.
+	DIOMapping RFM95W_DIOMapping
+	UseRFO     bool // The antenna is connected to RFO instead of PA_BOOST. RFM95W modules only have PA_BOOST connected.
+	Variant    int  // RF95W_VARIANT_*, for the supported frequencies. Default RF95W_VARIANT_RFM95.
+	// ppm. Crystal offset correction, e.g. from FrequencyCorrection() after an AFC run.
+	FrequencyCorrection float64
+}
+
+/*
+	New().
+	 Sets up the module with the given parameters (defaults if nil) and hardware options (defaults if nil).
+	 If a reset pin is configured, the module is reset before it is initialized. On error the pins and the SPI bus
+	 are released again.
+	 Several modules can be used in one process, each with its own pins. Modules on the same SPI device (the same
+	 DevicePath, or the same SPIBus) must each have a CS pin, their transfers are serialised.
+*/
+
+func New(params *RFM95W_Params, opts *RFM95W_Options) (*RFM95W, error) {
+	var o RFM95W_Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.DevicePath == "" {
+		o.DevicePath = RF95W_SPI_DEV
+	}
+	if o.SPISpeed == 0 {
+		o.SPISpeed = RF95W_SPI_SPEED
+	}
+	if o.SettleTime == 0 {
+		o.SettleTime = RF95W_SETTLE_TIME
+	}
+	if o.GPIO == nil {
+		// Initialize GPIO library.
+		o.GPIO = NewWiringPiGPIO()
+	}
+	if o.Pins == nil {
+		o.Pins = &RF95W_DEFAULT_PINS
+	}
+	variant, ok := RFM95W_Variants[o.Variant]
+	if !ok {
+		return nil, errors.New("Invalid module variant requested.")
+	}
+	if o.FrequencyCorrection < -RF95W_AFC_MAX_PPM || o.FrequencyCorrection > RF95W_AFC_MAX_PPM {
+		return nil, errors.New("Invalid frequency correction requested.")
+	}
 	if params == nil {
 		// Default parameters.
+		sf := RF95W_DEFAULT_SF
+		if sf > variant.MaxSF {
+			sf = variant.MaxSF
+		}
 		params = &RFM95W_Params{
-			TransmitMode:    RF95W_MODE_LORA,
-			Frequency:       RF95W_DEFAULT_FREQ,
+			TransmitMode:    RF95W_TRANSMIT_LORA,
+			Frequency:       variant.DefaultFrequency,
 			Bandwidth:       RF95W_DEFAULT_BW,
-			SpreadingFactor: RF95W_DEFAULT_SF,
+			SpreadingFactor: sf,
 			CodingRate:      RF95W_DEFAULT_CR,
 			PreambleLength:  RF95W_DEFAULT_PR,
 		}
 	}
-	// Initialize GPIO library.
-	rpi.WiringPiSetup()
-
-	// Set up the CS and interrupt (DIO0) pins.
-	rpi.PinMode(RF95W_CS_PIN, rpi.OUTPUT)      // Chip Select.
-	rpi.PinMode(RF95W_DIO0_INT_PIN, rpi.INPUT) // DIO0 interrupt.
-	rpi.PinMode(RF95W_ACT_PIN, rpi.OUTPUT)     // ACT LED.
+	err := (&RFM95W{useRFO: o.UseRFO, variant: o.Variant}).validateParams(*params)
+	if err != nil {
+		return nil, err
+	}
 
-	rpi.DigitalWrite(RF95W_CS_PIN, rpi.HIGH)
-	rpi.DigitalWrite(RF95W_ACT_PIN, rpi.LOW)
+	bus := o.SPI
+	var busKey interface{} = bus
+	if bus == nil {
+		bus, err = OpenSPI(o.DevicePath, o.SPIMode, o.SPISpeed)
+		if err != nil {
+			return nil, err
+		}
+		busKey = o.DevicePath
+	}
 
-	spiDev := &spi.Devfs{
-		Dev:      "/dev/spidev0.0",
-		Mode:     spi.Mode0,
-		MaxSpeed: 8000000,
+	_, dio0 := o.Pins.DIO0.Get()
+	ret := &RFM95W{
+		SPI:           bus,
+		GPIO:          o.GPIO,
+		Pins:          *o.Pins,
+		useRFO:        o.UseRFO,
+		variant:       o.Variant,
+		ppmCorrection: o.FrequencyCorrection,
+		mode:          RFM95W_TransmitModes[params.TransmitMode],
+		settings:      *params,
+		polling:       o.Polling || !dio0,
+		dioMapping:    o.DIOMapping,
+		ownBus:        o.SPI == nil,
 	}
+	ret.claimBus(busKey)
 
-	SPI, err := spi.Open(spiDev)
+	// Set up the CS, interrupt (DIO0-DIO5), ACT LED and reset pins.
+	err = ret.claimPins()
 	if err != nil {
+		ret.closeBus()
 		return nil, err
 	}
-
-	SPI.SetBitOrder(spi.MSBFirst)
-	SPI.SetCSChange(false)
-
-	ret := &RFM95W{
-		SPI:      SPI,
-		mode:     0, // FIXME.
-		settings: *params,
+	err = ret.setupPins()
+	if err != nil {
+		ret.releasePins()
+		ret.closeBus()
+		return nil, err
 	}
 
 	// Variables that need initializing.
 	ret.txQueue = make(chan []byte, 1024)
 	ret.stopQueue = make(chan int)
+	ret.jobQueue = make(chan *queueJob)
 	ret.mu_Recv = &sync.Mutex{}
 	ret.mu_Send = &sync.Mutex{}
+	ret.mu_Queue = &sync.Mutex{}
+	ret.mu_AFC = &sync.Mutex{}
 
-	time.Sleep(100 * time.Millisecond)
+	time.Sleep(o.SettleTime)
+
+	if _, ok := ret.Pins.RESET.Get(); ok {
+		err = ret.Reset()
+		if err != nil {
+			ret.releasePins()
+			ret.closeBus()
+			return nil, err
+		}
+	}
 
 	err = ret.init()
+	if err != nil {
+		ret.releasePins()
+		ret.closeBus()
+		return nil, err
+	}
 
-	return ret, err
+	return ret, nil
 }
 
+/*
+	SetMode().
+	 Writes RegOpMode. Unless mode selects LoRa, the bits of the current modem are added, and LowFrequencyModeOn is
+	 added for frequencies in the LF band.
+	 While the queue handler runs it owns the mode: use ChannelActive() for CAD.
+*/
+
 func (r *RFM95W) SetMode(mode byte) error {
-	_, err := r.SetRegister(0x01, mode) // RegOpMode.
+	val := mode
+	if val&RF95W_MODE_LORA == 0 {
+		val |= byte(r.mode)
+	}
+	if r.lowFrequency {
+		val |= RF95W_MODE_LF
+	}
+	_, err := r.SetRegister(RF95W_REG_OPMODE, val)
 	if err == nil {
-		r.currentMode = mode
+		r.currentMode = RF95W_FIELD_MODE.Get(mode)
 	}
 	return err
 }
 
+/*
+	GetMode().
+	 Reads RegOpMode, without LowFrequencyModeOn.
+*/
+
 func (r *RFM95W) GetMode() (byte, error) {
-	ret, err := r.GetRegister(0x01) // RegOpMode.
+	ret, err := r.GetRegister(RF95W_REG_OPMODE)
+	ret &^= RF95W_MODE_LF
 	if err == nil {
-		r.currentMode = ret
+		r.currentMode = RF95W_FIELD_MODE.Get(ret)
 	}
 	return ret, err
 }
 
+/*
+	setModem().
+	 Switches between the LoRa and FSK/OOK modems (RF95W_MODE_LORA, RF95W_MODE_FSK, RF95W_MODE_OOK). LongRangeMode
+	 can only be changed in SLEEP, the module is left there.
+*/
+
+func (r *RFM95W) setModem(modem int) error {
+	err := r.SetMode(RF95W_MODE_SLEEP)
+	if err != nil {
+		return err
+	}
+	r.mode = modem
+	return r.SetMode(RF95W_MODE_SLEEP)
+}
+
+/*
+	isLoRa().
+	 True if the LoRa modem is selected.
+*/
+
+func (r *RFM95W) isLoRa() bool {
+	return r.mode == RF95W_MODE_LORA
+}
+
 /*
 	Close().
-	 Cleanup functions. Shut down the module and close the SPI handle.
+	 Cleanup functions. Shut down the module, close the SPI handle and release the pins.
 */
 
 func (r *RFM95W) Close() {
 	// Put the module to sleep when it is not in use.
 	r.SetMode(RF95W_MODE_SLEEP)
-	r.SPI.Close()
+	r.setACT(false)
+	r.closeBus()
+	// Let another instance use the pins.
+	r.releasePins()
 }
 
 func (r *RFM95W) setParams(param RFM95W_Params) {
-	r.SetBandwidth(param.Bandwidth)
-	r.SetSpreadingFactor(param.SpreadingFactor)
-	r.SetCodingRate(param.CodingRate)
-	r.SetPreambleLength(param.PreambleLength)
+	if r.isLoRa() {
+		r.SetBandwidth(param.Bandwidth)
+		r.SetSpreadingFactor(param.SpreadingFactor)
+		r.SetCodingRate(param.CodingRate)
+		r.SetPreambleLength(param.PreambleLength)
+		r.SetCRC(param.CRC)
+		syncWord := param.SyncWord
+		if syncWord == 0 {
+			syncWord = RF95W_SYNCWORD_PRIVATE
+		}
+		r.SetSyncWord(byte(syncWord))
+	} else {
+		r.setFSKParams(param)
+	}
 	r.SetFrequency(param.Frequency)
+	r.setFrequencyCorrection(r.ppmCorrection)
+	txPower := param.TXPower
+	if txPower == 0 {
+		// Limited to the RFO maximum.
+		_, max := txPowerRange(r.useRFO)
+		txPower = RF95W_DEFAULT_TXPOWER
+		if txPower > max {
+			txPower = max
+		}
+	}
+	r.SetTXPower(txPower)
 }
 
+/*
+	SetParams().
+	 Applies a new set of parameters. This runs through queueHandler, so that it doesn't interrupt TX or a packet
+	 being received, then the module goes back to receiving with the new settings.
+*/
+
 func (r *RFM95W) SetParams(param RFM95W_Params) error {
-	if r.currentMode == RF95W_MODE_TX {
-		return errors.New("SetParams(): Not ready.")
+	err := r.validateParams(param)
+	if err != nil {
+		return err
 	}
+	return r.runJob(func() error {
+		r.mu_Send.Lock()
+		defer r.mu_Send.Unlock()
 
-	r.SetMode(RF95W_MODE_STDBY)
+		if r.currentMode == RF95W_MODE_TX {
+			return errors.New("SetParams(): Not ready.")
+		}
+
+		r.SetMode(RF95W_MODE_STDBY)
+
+		r.settings = param
+		err := r.init()
 
-	r.settings = param
-	err := r.init()
+		if err != nil {
+			return err
+		}
 
+		r.setRXMode()
+
+		return nil
+	})
+}
+
+/*
+	validateParams().
+	 Checks that all parameters are in range, before any of them are applied.
+*/
+
+func (r *RFM95W) validateParams(param RFM95W_Params) error {
+	err := checkFrequency(r.variant, param.Frequency)
 	if err != nil {
 		return err
 	}
+	if param.TXPower != 0 {
+		min, max := txPowerRange(r.useRFO)
+		if param.TXPower < min || param.TXPower > max {
+			return errors.New("Invalid TX power requested.")
+		}
+	}
+	if param.TransmitMode&(RF95W_MODE_LORA|RF95W_MODE_OOK) != 0 {
+		return errors.New("Invalid transmit mode requested, use RF95W_TRANSMIT_* rather than RF95W_MODE_*.")
+	}
+	modem, ok := RFM95W_TransmitModes[param.TransmitMode]
+	if !ok {
+		return errors.New("Invalid transmit mode requested.")
+	}
+	if modem == RF95W_MODE_LORA {
+		return r.validateLoRaParams(param)
+	}
+	return validateFSKParams(param)
+}
 
-	r.setRXMode()
+/*
+	validateLoRaParams().
+	 The LoRa specific part of validateParams().
+*/
 
+func (r *RFM95W) validateLoRaParams(param RFM95W_Params) error {
+	if _, ok := RFM95W_Bandwidths[param.Bandwidth]; !ok {
+		return errors.New("Invalid bandwidth requested.")
+	}
+	if !r.validSpreadingFactor(param.SpreadingFactor) {
+		return errors.New("Invalid spreading factor requested.")
+	}
+	if param.CodingRate < 5 || param.CodingRate > 8 {
+		return errors.New("Invalid coding rate requested.")
+	}
+	if param.PreambleLength < 6 || param.PreambleLength > 65535 {
+		return errors.New("Invalid preamble length requested.")
+	}
+	if param.HeaderMode != RF95W_HEADER_EXPLICIT && param.HeaderMode != RF95W_HEADER_IMPLICIT {
+		return errors.New("Invalid header mode requested.")
+	}
+	if (param.HeaderMode == RF95W_HEADER_IMPLICIT || param.SpreadingFactor == 6) && !validPayloadLength(param.PayloadLength) {
+		return errors.New("Implicit header mode requires a fixed payload length (PayloadLength).")
+	}
+	if !validSetting(param.LowDataRateOptimize) || !validSetting(param.AGC) {
+		return errors.New("Invalid LowDataRateOptimize or AGC setting requested.")
+	}
+	if param.SyncWord < 0 || param.SyncWord > 0xFF {
+		return errors.New("Invalid sync word requested.")
+	}
 	return nil
 }
 
-func (r *RFM95W) init() error {
-	i := 0
-	for i = 0; i < 10; i++ {
+func validSetting(s int) bool {
+	return s == RF95W_SETTING_AUTO || s == RF95W_SETTING_ON || s == RF95W_SETTING_OFF
+}
+
+/*
+	Chip detection errors returned by init().
+	 NoChipError:    Nothing answered on the SPI bus (RegVersion read as 0x00 or 0xFF).
+	 WrongChipError: Something answered, but it is not an SX1276.
+	 ChipStuckError: The chip was identified but did not accept a mode change.
+*/
+
+type NoChipError struct {
+	Version byte
+}
+
+func (e *NoChipError) Error() string {
+	return fmt.Sprintf("Init failed - no module found (RegVersion=%02x).", e.Version)
+}
+
+type WrongChipError struct {
+	Version byte
+}
+
+func (e *WrongChipError) Error() string {
+	return fmt.Sprintf("Init failed - unsupported chip (RegVersion=%02x, expected %02x).", e.Version, RF95W_CHIP_VERSION)
+}
+
+type ChipStuckError struct {
+	Mode byte
+}
+
+func (e *ChipStuckError) Error() string {
+	return fmt.Sprintf("Init failed - couldn't set mode on module (RegOpMode=%02x).", e.Mode)
+}
+
+/*
+	detectChip().
+	 Reads and verifies the silicon version, then checks that the module responds by putting it into LoRa SLEEP mode.
+*/
+
+func (r *RFM95W) detectChip() error {
+	version, err := r.GetRegister(RF95W_REG_VERSION)
+	if err != nil {
+		return err
+	}
+	if version == 0x00 || version == 0xFF {
+		return &NoChipError{Version: version}
+	}
+	if version != RF95W_CHIP_VERSION {
+		return &WrongChipError{Version: version}
+	}
+	r.ChipVersion = version
+
+	var mode byte
+	for i := 0; i < 10; i++ {
 		// Retry setting the mode 10 times.
 		r.SetMode(RF95W_MODE_SLEEP | RF95W_MODE_LORA)
 
 		time.Sleep(10 * time.Millisecond)
 
-		mode, err := r.GetMode()
+		mode, err = r.GetMode()
 		if err != nil {
 			return err
 		}
 
 		// Use the "mode" setting to check connection.
 		if mode == RF95W_MODE_SLEEP|RF95W_MODE_LORA {
-			break
+			return nil
 		}
 	}
-	if i == 10 { // 10 retries was not enough - some issue.
-		return errors.New("Init failed - couldn't set mode on module.")
+	// 10 retries was not enough - some issue.
+	return &ChipStuckError{Mode: mode}
+}
+
+func (r *RFM95W) init() error {
+	err := r.detectChip()
+	switch err.(type) {
+	case *NoChipError, *ChipStuckError:
+		// Try to recover with a hardware reset, if we can.
+		if _, ok := r.Pins.RESET.Get(); ok {
+			if r.Debug {
+				fmt.Printf("init(): %s Resetting module.\n", err.Error())
+			}
+			if rerr := r.Reset(); rerr != nil {
+				return rerr
+			}
+			err = r.detectChip()
+		}
+	}
+	if err != nil {
+		return err
 	}
 
-	// Set up the WiringPi interrupt for DIO0, if it is not yet set up.
-	if r.interruptChan == nil {
-		r.interruptChan = rpi.WiringPiISR(RF95W_DIO0_INT_PIN, rpi.INT_EDGE_RISING)
+	// Set up the DIO interrupts, if they are not yet set up.
+	if r.interruptChan == nil && !r.polling {
+		err := r.setupInterrupts()
+		if err != nil {
+			return err
+		}
 	}
+	r.setDIOMapping2()
 
-	// Set base addresses of the FIFO buffer in both TX and RX cases to zero.
-	r.SetRegister(0x0E, 0x00) // RegFifoTxBaseAddr.
-	r.SetRegister(0x0F, 0x00) // RegFifoRxBaseAddr.
+	// detectChip() left the module in LoRa SLEEP.
+	r.mode = RF95W_MODE_LORA
+	if modem := RFM95W_TransmitModes[r.settings.TransmitMode]; modem != RF95W_MODE_LORA {
+		err = r.setModem(modem)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Set base addresses of the FIFO buffer in both TX and RX cases to zero.
+		r.SetRegister(RF95W_REG_FIFOTXBASEADDR, 0x00)
+		r.SetRegister(RF95W_REG_FIFORXBASEADDR, 0x00)
+	}
 
 	// Set module to STDBY mode.
 	r.SetMode(RF95W_MODE_STDBY)
@@ -210,8 +593,6 @@ func (r *RFM95W) init() error {
 
 	r.setLNASettings()
 
-	r.SetTXPower()
-
 	return nil
 }
 
@@ -220,97 +601,142 @@ func (r *RFM95W) init() error {
 	 Sets the LNA gain and boost values.
 */
 func (r *RFM95W) setLNASettings() {
-	// G1 = maximum gain. LnaBoostHf on.
-	r.SetRegister(0x0C, 0x23) // RegLna.
-	//FIXME: See RegModemConfig3. AgcAutoOn.
+	// G1 = maximum gain, used when the AGC is off. LnaBoostHf on.
+	r.SetField(RF95W_FIELD_LNAGAIN, 1)
+	r.SetField(RF95W_FIELD_LNABOOSTHF, 3)
 }
 
 /*
 	SetBandwidth().
-	 Sets the total bandwidth to use in the transmission.
+	 Sets the total bandwidth to use in the transmission. FSK: sets the receiver bandwidth.
 */
 
 func (r *RFM95W) SetBandwidth(bw int) error {
+	if !r.isLoRa() {
+		return r.setFSKBandwidth(bw)
+	}
 	b, ok := RFM95W_Bandwidths[bw]
 	if !ok {
 		return errors.New("Invalid bandwidth requested.")
 	}
-	// Get initial value.
-	val, err := r.GetRegister(0x1D) // RegModemConfig1.
+	err := r.SetField(RF95W_FIELD_BW, b)
 	if err != nil {
 		return err
 	}
-	// Set only the bandwidth portion.
-	new_val := (val & 0x0F) | (b << 4)
-	if r.Debug {
-		fmt.Printf("SetBandwidth(): %02x -> %02x\n", val, new_val)
-	}
-	_, err = r.SetRegister(0x1D, new_val) // RegModemConfig1.
+	r.settings.Bandwidth = bw
+	err = r.setHighBWOptimize()
 	if err != nil {
-		r.settings.Bandwidth = bw
+		return err
 	}
-	return err
+	// The symbol time changed.
+	return r.setModemConfig3()
 }
 
 /*
-	SetExplicitHeaderMode().
-	 True or false - include explicit header.
-	 Currently always setting "false" on init since no other header handling is implemented.
+	SetPreambleLength().
+	 Sets the preamble length, from 6-65535.
+	 Default value is 8. FSK: in bytes, from 1-65535.
 */
-
-func (r *RFM95W) SetExplicitHeaderMode(wantHeader bool) error {
-	// Get initial value.
-	val, err := r.GetRegister(0x1D) // RegModemConfig1.
-	if err != nil {
-		return err
+func (r *RFM95W) SetPreambleLength(pr int) error {
+	min, msb, lsb := 6, byte(RF95W_REG_PREAMBLEMSB), byte(RF95W_REG_PREAMBLELSB)
+	if !r.isLoRa() {
+		min, msb, lsb = 1, RF95W_REG_FSK_PREAMBLEMSB, RF95W_REG_FSK_PREAMBLELSB
 	}
-	var b byte
-	if !wantHeader {
-		b = 0x1
+	if pr < min || pr > 65535 {
+		return errors.New("Invalid preamble length requested.")
 	}
-	// Set only the header portion.
-	new_val := (val & 0xFE) | b
-	if r.Debug {
-		fmt.Printf("SetExplicitHeaderMode(): %02x -> %02x\n", val, new_val)
+	r.SetRegister(msb, byte(pr>>8))
+	_, err := r.SetRegister(lsb, byte(pr&0xFF))
+	if err == nil {
+		r.settings.PreambleLength = pr
 	}
-	_, err = r.SetRegister(0x1D, new_val) // RegModemConfig1.
 	return err
 }
 
 /*
-	SetPreambleLength().
-	 Sets the preamble length, from 6-65535.
-	 Default value is 8.
+	SetTXPower().
+	 Sets the output power in dBm. PA_BOOST: 2-17, or 18-20 using the high power PA (max 1% duty cycle).
+	 RFO (RFM95W_Options.UseRFO): -4-15. The over-current protection limit is set to match.
 */
-func (r *RFM95W) SetPreambleLength(pr int) error {
-	if pr < 6 {
-		return errors.New("Invalid preamble length requested.")
+
+func (r *RFM95W) SetTXPower(dBm int) error {
+	min, max := txPowerRange(r.useRFO)
+	if dBm < min || dBm > max {
+		return errors.New("Invalid TX power requested.")
+	}
+	var paSelect, maxPower, outputPower, paDac byte
+	ocp := RF95W_OCP_DEFAULT
+	paDac = RF95W_PADAC_DEFAULT
+	if r.useRFO {
+		// Pout = Pmax - (15 - OutputPower), Pmax = 10.8 + 0.6 * MaxPower.
+		if dBm < 0 {
+			maxPower, outputPower = 0, byte(dBm+4) // Pmax = 10.8 dBm.
+		} else {
+			maxPower, outputPower = 7, byte(dBm) // Pmax = 15 dBm.
+		}
+	} else {
+		paSelect = 1
+		// Pout = 17 - (15 - OutputPower), +3 dB with the high power PA.
+		if dBm > 17 {
+			paDac = RF95W_PADAC_20DBM
+			outputPower = byte(dBm - 5)
+			ocp = RF95W_OCP_20DBM
+		} else {
+			outputPower = byte(dBm - 2)
+		}
+	}
+
+	var val byte
+	val = RF95W_FIELD_PASELECT.Set(val, paSelect)
+	val = RF95W_FIELD_MAXPOWER.Set(val, maxPower)
+	val = RF95W_FIELD_OUTPUTPOWER.Set(val, outputPower)
+	if r.Debug {
+		fmt.Printf("SetTXPower(): %d dBm, RegPaConfig=%02x, PaDac=%d, OCP=%d mA\n", dBm, val, paDac, ocp)
 	}
-	r.SetRegister(0x20, byte(pr>>8))             // RegPreambleMsb.
-	_, err := r.SetRegister(0x21, byte(pr&0xFF)) // RegPreambleLsb.
+	err := r.SetField(RF95W_FIELD_PADAC, paDac)
 	if err != nil {
-		r.settings.PreambleLength = pr
+		return err
+	}
+	_, err = r.SetRegister(RF95W_REG_PACONFIG, val)
+	if err != nil {
+		return err
+	}
+	err = r.setOCP(ocp)
+	if err == nil {
+		r.settings.TXPower = dBm
 	}
 	return err
 }
 
-func (r *RFM95W) SetFrequency(freq uint64) error {
-	steps := uint32(float64(freq) / RF95W_FREQ_STEP)
-	r.SetRegister(0x06, byte(steps>>16))            // RegFrMsb.
-	r.SetRegister(0x07, byte((steps>>8)&0xFF))      // RegFrMid.
-	_, err := r.SetRegister(0x08, byte(steps&0xFF)) // RegFrLsb.
-	if err != nil {
-		r.settings.Frequency = freq
+// TX power range in dBm for the PA_BOOST or RFO output.
+func txPowerRange(useRFO bool) (int, int) {
+	if useRFO {
+		return -4, 15
 	}
-	return err
+	return 2, 20
 }
 
 /*
-	SetTXPower().
-//FIXME:	 Always run at 17 dBm for now.
+	setOCP().
+	 Enables the over-current protection with the given limit (45-240 mA).
 */
-func (r *RFM95W) SetTXPower() error {
-	_, err := r.SetRegister(0x09, 0x8F) // RegPaConfig.
+
+func (r *RFM95W) setOCP(mA int) error {
+	var trim byte
+	switch {
+	case mA <= 45:
+		trim = 0
+	case mA <= 120:
+		trim = byte((mA - 45) / 5) // Imax = 45 + 5 * OcpTrim.
+	case mA <= 240:
+		trim = byte((mA + 30) / 10) // Imax = -30 + 10 * OcpTrim.
+	default:
+		trim = 27
+	}
+	var val byte
+	val = RF95W_FIELD_OCPON.Set(val, 1)
+	val = RF95W_FIELD_OCPTRIM.Set(val, trim)
+	_, err := r.SetRegister(RF95W_REG_OCP, val)
 	return err
 }
 
@@ -320,8 +746,9 @@ func (r *RFM95W) SetTXPower() error {
 */
 
 func (r *RFM95W) Send(msg []byte) error {
-	if len(msg) > 255 {
-		return errors.New("Message too long.")
+	err := r.checkMessage(msg)
+	if err != nil {
+		return err
 	}
 
 	r.txQueue <- msg
@@ -334,7 +761,11 @@ func (r *RFM95W) Send(msg []byte) error {
 */
 
 func (r *RFM95W) SendSync(msg []byte) error {
-	err := r.sendMessage(msg)
+	err := r.checkMessage(msg)
+	if err != nil {
+		return err
+	}
+	err = r.sendMessage(msg)
 	if err == nil {
 		for r.currentMode == RF95W_MODE_TX {
 			time.Sleep(50 * time.Millisecond)
@@ -343,34 +774,66 @@ func (r *RFM95W) SendSync(msg []byte) error {
 	return err
 }
 
+/*
+	checkMessage().
+	 Checks that the message can be sent with the current settings.
+*/
+
+func (r *RFM95W) checkMessage(msg []byte) error {
+	if !r.isLoRa() {
+		return r.checkFSKMessage(msg)
+	}
+	if len(msg) > 255 {
+		return errors.New("Message too long.")
+	}
+	if r.implicitHeader() && len(msg) != r.settings.PayloadLength {
+		return errors.New("Message length must be PayloadLength in implicit header mode.")
+	}
+	return nil
+}
+
 func (r *RFM95W) sendMessage(msg []byte) error {
 	r.mu_Send.Lock()
 	defer r.mu_Send.Unlock()
 
 	r.SetMode(RF95W_MODE_STDBY)
 
-	rpi.DigitalWrite(RF95W_ACT_PIN, rpi.HIGH) // Turn on ACT LED.
+	r.setACT(true) // Turn on ACT LED.
+
+	if !r.isLoRa() {
+		err := r.writeFSKPacket(msg)
+		if err != nil {
+			return err
+		}
+		r.txStart = time.Now()
+		return r.SetMode(RF95W_MODE_TX)
+	}
 
 	// Set the FIFO address pointer to the start.
-	_, err := r.SetRegister(0x0D, 0x00) // RegFifoAddrPtr.
+	_, err := r.SetRegister(RF95W_REG_FIFOADDRPTR, 0x00)
 	if err != nil {
 		return err
 	}
 
 	// Write the message into the FIFO buffer.
-	_, err = r.SetBytes(0x00, msg) // RegFifo.
+	_, err = r.SetBytes(RF95W_REG_FIFO, msg)
 	if err != nil {
 		return err
 	}
 
 	// Set the message payload length register.
-	_, err = r.SetRegister(0x22, byte(len(msg))) // PayloadLength.
+	_, err = r.SetRegister(RF95W_REG_PAYLOADLENGTH, byte(len(msg)))
+	if err != nil {
+		return err
+	}
+
+	err = r.setInvertIQ(true)
 	if err != nil {
 		return err
 	}
 
 	// Change DIOx interrupt mapping so that DIO0 interrupts on TxDone.
-	_, err = r.SetRegister(0x40, 0x40) // RegDioMapping1.
+	err = r.setDIOMapping(RF95W_DIO0_TXDONE)
 	if err != nil {
 		return err
 	}
@@ -382,27 +845,253 @@ func (r *RFM95W) sendMessage(msg []byte) error {
 }
 
 func (r *RFM95W) setRXMode() error {
-	err := r.SetMode(RF95W_MODE_RXCONTINUOUS)
+	if !r.isLoRa() {
+		return r.setFSKRXMode()
+	}
+	err := r.setInvertIQ(false)
+	if err != nil {
+		return err
+	}
+
+	err = r.SetMode(RF95W_MODE_RXCONTINUOUS)
 	if err != nil {
 		return err
 	}
 
 	// Change DIOx interrupt mapping so that DIO0 interrupts on RxDone.
-	_, err = r.SetRegister(0x40, 0x00) // RegDioMapping1.
+	err = r.setDIOMapping(RF95W_DIO0_RXDONE)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+/*
+	readPacket().
+	 Reads the last received packet out of the FIFO and appends it to RecvBuf. crcValid is false if the payload CRC
+	 check failed.
+*/
+
+func (r *RFM95W) readPacket(received time.Time, crcValid bool) error {
+	if !r.isLoRa() {
+		return r.readFSKPacket(received, crcValid)
+	}
+	// Get the total length of the packet.
+	msgLen, err := r.GetRegister(RF95W_REG_RXNBBYTES)
+	if err != nil {
+		return fmt.Errorf("can't get length: %s", err.Error())
+	}
+	// Get the start address in the FIFO queue.
+	fifoPtr, err := r.GetRegister(RF95W_REG_FIFORXCURRENTADDR)
+	if err != nil {
+		return fmt.Errorf("can't get start pointer address: %s", err.Error())
+	}
+	// Set the read address to the start of the message in the FIFO queue.
+	_, err = r.SetRegister(RF95W_REG_FIFOADDRPTR, fifoPtr)
+	if err != nil {
+		return fmt.Errorf("can't set FIFO pointer: %s", err.Error())
+	}
+	// Read the data.
+	msgBuf, err := r.GetBytes(RF95W_REG_FIFO, int(msgLen))
+	if err != nil {
+		return fmt.Errorf("can't read FIFO buffer: %s", err.Error())
+	}
+	// Get some extra stats - SNR, RSSI, etc.
+	snrByte, _ := r.GetRegister(RF95W_REG_PKTSNRVALUE)
+	rssiByte, _ := r.GetRegister(RF95W_REG_PKTRSSIVALUE)
+	var newMessage RFM95W_Message
+	newMessage.RSSI, newMessage.SignalRSSI, newMessage.SNR = r.packetRSSI(rssiByte, snrByte)
+	newMessage.Buf = msgBuf
+	newMessage.Received = received
+	newMessage.Params = r.settings
+	newMessage.CRCValid = crcValid
+	newMessage.FrequencyError, err = r.readFrequencyError()
+	if err == nil && crcValid && r.settings.AFC {
+		r.trackFrequencyError(newMessage.FrequencyError)
+	}
+	if !r.implicitHeader() {
+		// Header info of the received packet.
+		cr, _ := r.GetField(RF95W_FIELD_RXCODINGRATE)
+		newMessage.CodingRate = int(cr) + 4
+		newMessage.CRCPresent, _ = r.GetFlag(RF95W_FIELD_CRCONPAYLOAD)
+	}
+	r.mu_Recv.Lock()
+	r.RecvBuf = append(r.RecvBuf, newMessage)
+	r.mu_Recv.Unlock()
+	return nil
+}
+
+/*
+	startNextTX().
+	 Starts sending the first message in txWaiting. Returns the remaining TX queue.
+*/
+
+func (r *RFM95W) startNextTX(txWaiting [][]byte) [][]byte {
+	if r.Debug {
+		fmt.Printf("queuehandler() starting new transmission.\n")
+	}
+	// Switch to transmit mode.
+	err := r.sendMessage(txWaiting[0])
+	if err != nil {
+		fmt.Printf("queueHandler() send message error: %s\n", err.Error())
+	} else {
+		txWaiting = txWaiting[1:] // Message was buffered to the radio successfully.
+	}
+	return txWaiting
+}
+
+/*
+	queueJob.
+	 An operation that needs the radio to itself (e.g. ScanRSSI()). It is run by queueHandler when the radio is free,
+	 and TX is held off until it finishes. The job leaves the module in STDBY.
+*/
+
+type queueJob struct {
+	run  func() error
+	done chan error
+}
+
+/*
+	runJob().
+	 Runs a job through queueHandler and waits for it to finish. Without a running queue handler, the job is run
+	 directly.
+*/
+
+func (r *RFM95W) runJob(run func() error) error {
+	r.mu_Queue.Lock()
+	running, queueDone := r.queueRunning, r.queueDone
+	r.mu_Queue.Unlock()
+	if !running {
+		return run()
+	}
+	job := &queueJob{run: run, done: make(chan error, 1)}
+	select {
+	case r.jobQueue <- job:
+		return <-job.done
+	case <-queueDone:
+		// Stopped meanwhile.
+		return run()
+	}
+}
+
+/*
+	resume().
+	 Called when the radio is free: runs waiting jobs first and applies a pending AFC correction, then sends
+	 waiting messages, otherwise goes back to receive mode. Returns the remaining TX queue.
+*/
+
+func (r *RFM95W) resume(txWaiting [][]byte) [][]byte {
+	for len(r.jobWaiting) > 0 {
+		job := r.jobWaiting[0]
+		r.jobWaiting = r.jobWaiting[1:]
+		job.done <- job.run()
+	}
+	if r.afcPending {
+		err := r.applyFrequencyCorrection()
+		if err != nil && r.Debug {
+			fmt.Printf("queueHandler() can't apply the frequency correction: %s\n", err.Error())
+		}
+	}
+	// Are there more messages that we need to send? Always empty the queue before starting to receive.
+	if len(txWaiting) > 0 {
+		return r.startNextTX(txWaiting)
+	}
+	// No more messages waiting to transmit, go back to receive mode.
+	if r.Debug {
+		fmt.Printf("queueHandler() finished sending all TX messages, switching back to RX mode.\n")
+	}
+	r.setACT(false) // Turn off ACT LED.
+	r.setRXMode()
+	return txWaiting
+}
+
+/*
+	handleIRQ().
+	 Acts on the IRQ flags read from RegIrqFlags, either after a DIO interrupt or when polling.
+	 t is the time of the interrupt (or poll). Returns the remaining TX queue.
+*/
+
+func (r *RFM95W) handleIRQ(irqFlags byte, t time.Time, txWaiting [][]byte) [][]byte {
+	// Clear the IRQ flags before acting on them, so that an IRQ raised by the next operation isn't lost.
+	r.clearIRQFlags(irqFlags)
+	if r.Debug {
+		fmt.Printf("queueHandler() interrupt received, currentMode=%02x, irqFlags=%02x\n", r.currentMode, irqFlags)
+	}
+	switch r.currentMode {
+	case RF95W_MODE_TX:
+		if irqFlags&RF95W_IRQ_FLAG_TXDONE != 0 {
+			// TX finished.
+			r.LastTXTime = t.Sub(r.txStart)
+			if r.Debug {
+				fmt.Printf("queueHandler() transmit finished, t=%dms.\n", r.LastTXTime/time.Millisecond)
+			}
+			txWaiting = r.resume(txWaiting)
+		}
+	case RF95W_MODE_RXCONTINUOUS:
+		if irqFlags&RF95W_IRQ_FLAG_VALIDHEADER != 0 && irqFlags&RF95W_IRQ_FLAG_RXDONE == 0 {
+			// Header received, the rest of the packet is on its way. Hold off TX until it is in.
+			if !r.rxOngoing && !r.isLoRa() {
+				// FSK/OOK: take the packet RSSI while the signal is on.
+				rssi, err := r.currentRSSI()
+				r.syncRSSI, r.syncRSSIValid = rssi, err == nil
+			}
+			r.rxOngoing = true
+			if r.Debug {
+				fmt.Printf("queueHandler() received valid header.\n")
+			}
+		}
+		if irqFlags&(RF95W_IRQ_FLAG_RXTIMEOUT|RF95W_IRQ_FLAG_PAYLOADCRCERROR|RF95W_IRQ_FLAG_RXDONE) != 0 {
+			r.rxOngoing = false
+		}
+		if irqFlags&RF95W_IRQ_FLAG_RXTIMEOUT != 0 {
+			// Timeout. Do nothing, since we're receiving in continuous mode.
+		} else if irqFlags&RF95W_IRQ_FLAG_PAYLOADCRCERROR != 0 && !r.DeliverCRCErrors {
+			if r.Debug {
+				fmt.Printf("queueHandler() received packet with CRC error, discarding.\n")
+			}
+			if !r.isLoRa() {
+				// With CrcAutoClearOff still set from an earlier DeliverCRCErrors, the packet stays in the FIFO.
+				err := r.clearFSKFIFO()
+				if err != nil {
+					fmt.Printf("queueHandler() error clearing FIFO, %s\n", err.Error())
+				}
+			}
+		} else if irqFlags&RF95W_IRQ_FLAG_RXDONE != 0 {
+			if r.Debug && irqFlags&RF95W_IRQ_FLAG_PAYLOADCRCERROR != 0 {
+				fmt.Printf("queueHandler() received RXDONE with CRC error, delivering (DeliverCRCErrors).\n")
+			} else if r.Debug {
+				fmt.Printf("queueHandler() received RXDONE.\n")
+			}
+			err := r.readPacket(t, irqFlags&RF95W_IRQ_FLAG_PAYLOADCRCERROR == 0)
+			if err != nil {
+				fmt.Printf("queueHandler() fatal error receiving packet, %s\n", err.Error())
+			}
+		}
+		if !r.rxOngoing && (len(txWaiting) > 0 || len(r.jobWaiting) > 0 || r.afcPending) {
+			// Reception finished, run what was held off.
+			txWaiting = r.resume(txWaiting)
+		}
+	}
+	return txWaiting
+}
+
 /*
 	queueHandler().
 	 Receives TX messages and coordinates transmissions between RX. TX takes priority, and the default mode of opreation is
-	 "RXCONTINUOUS".
-//FIXME: Check 0x18 RegModemStat/ModemStatus to see if "RX on-going" before switching to TX.
+	 "RXCONTINUOUS". A transmission is held off while a packet whose header has been received (ValidHeader) is still
+	 coming in, as long as RegModemStat reports "RX on-going".
+	 IRQs are taken from the DIO interrupts, or in polling mode by reading RegIrqFlags on an interval that starts at
+	 RF95W_POLL_MIN after each event and backs off to RF95W_POLL_MAX while idle. queueDone is closed on exit.
 */
 
-func (r *RFM95W) queueHandler() {
+func (r *RFM95W) queueHandler(queueDone chan struct{}) {
+	defer func() {
+		r.mu_Queue.Lock()
+		r.queueRunning = false
+		r.mu_Queue.Unlock()
+		close(queueDone)
+	}()
+
 	//FIXME: Assuming that we're ready to start sending/receiving once this goroutine is started.
 	err := r.setRXMode()
 	if err != nil {
@@ -412,99 +1101,70 @@ func (r *RFM95W) queueHandler() {
 		return
 	}
 
+	// Polling timer. pollChan stays nil (never fires) when using interrupts.
+	var pollTimer *time.Timer
+	var pollChan <-chan time.Time
+	pollInterval := RF95W_POLL_MIN
+	if r.polling {
+		pollTimer = time.NewTimer(pollInterval)
+		defer pollTimer.Stop()
+		pollChan = pollTimer.C
+	}
+
+	// Re-check timer while a reception holds up TX.
+	var deferChan <-chan time.Time
+
+	// Can TX start now? If not, check again later.
+	radioFree := func() bool {
+		if r.currentMode == RF95W_MODE_TX {
+			return false // Let the current operation finish.
+		}
+		if r.rxOngoing {
+			if deferChan == nil {
+				deferChan = time.After(RF95W_RX_DEFER_CHECK)
+			}
+			return false
+		}
+		return true
+	}
+
 	txWaiting := make([][]byte, 0)
 	for {
 		select {
-		case <-r.interruptChan:
+		case ev := <-r.interruptChan:
 			// Get the IRQ flags.
-			irqFlags, _ := r.GetRegister(0x12) // RegIrqFlags.
+			irqFlags, _ := r.getIRQFlags()
 			if r.Debug {
-				fmt.Printf("queueHandler() interrupt received, currentMode=%02x, irqFlags=%02x\n", r.currentMode, irqFlags)
+				fmt.Printf("queueHandler() DIO%d interrupt.\n", ev.Line)
 			}
-			switch r.currentMode {
-			case RF95W_MODE_TX:
-				if irqFlags&RF95W_IRQ_FLAG_TXDONE != 0 {
-					// TX finished.
-					txEnd := time.Now()
-					r.LastTXTime = txEnd.Sub(r.txStart)
-					if r.Debug {
-						fmt.Printf("queueHandler() transmit finished, t=%dms.\n", r.LastTXTime/time.Millisecond)
-					}
-					// Are there more messages that we need to send? Always empty the queue before starting to receive.
-					if len(txWaiting) > 0 {
-						if r.Debug {
-							fmt.Printf("queuehandler() starting new transmission.\n")
-						}
-						// Switch to transmit mode (again).
-						err := r.sendMessage(txWaiting[0])
-						if err != nil {
-							fmt.Printf("queueHandler() send message error: %s\n", err.Error())
-						} else {
-							txWaiting = txWaiting[1:] // Message was buffered to the radio successfully.
-						}
-					} else {
-						// No more messages waiting to transmit, go back to receive mode.
-						if r.Debug {
-							fmt.Printf("queueHandler() finished sending all TX messages, switching back to RX mode.\n")
-						}
-						rpi.DigitalWrite(RF95W_ACT_PIN, rpi.LOW) // Turn off ACT LED.
-						r.setRXMode()
-					}
-				}
-			case RF95W_MODE_RXCONTINUOUS:
-				if irqFlags&RF95W_IRQ_FLAG_RXTIMEOUT != 0 {
-					// Timeout. Do nothing, since we're receiving in continuous mode.
-				} else if irqFlags&RF95W_IRQ_FLAG_PAYLOADCRCERROR != 0 {
-					fmt.Printf("queueHandler() received packet with CRC error. discarding.\n")
-				} else if irqFlags&RF95W_IRQ_FLAG_RXDONE != 0 {
-					if r.Debug {
-						fmt.Printf("queueHandler() received RXDONE.\n")
-					}
-					// Get the total length of the packet.
-					msgLen, err := r.GetRegister(0x13) // FifoRxNbBytes.
-					if err != nil {
-						fmt.Printf("queueHandler() fatal error receiving packet, can't get length: %s\n", err.Error())
-						continue
-					}
-					// Get the start address in the FIFO queue.
-					fifoPtr, err := r.GetRegister(0x10) // RegFifoRxCurrentAddr.
-					if err != nil {
-						fmt.Printf("queueHandler() fatal error receiving packet, can't get start pointer address: %s\n", err.Error())
-						continue
-					}
-					// Set the read address to the start of the message in the FIFO queue.
-					_, err = r.SetRegister(0x0D, fifoPtr) // RegFifoAddrPtr.
-					if err != nil {
-						fmt.Printf("queueHandler() fatal error receiving packet, can't set FIFO pointer: %s\n", err.Error())
-						continue
-					}
-					// Read the data.
-					msgBuf, err := r.GetBytes(0x00, int(msgLen)) // RegFifo.
-					if err != nil {
-						fmt.Printf("queueHandler() fatal error receiving packet, can't read FIFO buffer: %s\n", err.Error())
-						continue
-					}
-					// Get some extra stats - SNR, RSSI, etc.
-					snrByte, _ := r.GetRegister(0x19)  // RegPktSnrValue.
-					rssiByte, _ := r.GetRegister(0x1A) // RegPktRssiValue.
-					//FIXME: Converting snr should be easier.
-					rdr := bytes.NewReader([]byte{snrByte})
-					var snr int8
-					binary.Read(rdr, binary.LittleEndian, &snr)
-					var newMessage RFM95W_Message
-					newMessage.SNR = float64(snr) / 4.0
-					newMessage.RSSI = int(rssiByte) - 137
-					newMessage.Buf = msgBuf
-					newMessage.Received = time.Now()
-					newMessage.Params = r.settings
-					r.mu_Recv.Lock()
-					r.RecvBuf = append(r.RecvBuf, newMessage)
-					r.mu_Recv.Unlock()
-
+			txWaiting = r.handleIRQ(irqFlags, ev.Time, txWaiting)
+		case t := <-pollChan:
+			irqFlags, err := r.getIRQFlags()
+			if err == nil && irqFlags != 0 {
+				txWaiting = r.handleIRQ(irqFlags, t, txWaiting)
+				pollInterval = RF95W_POLL_MIN
+			} else {
+				// Nothing happened, back off.
+				pollInterval *= 2
+				if pollInterval > RF95W_POLL_MAX {
+					pollInterval = RF95W_POLL_MAX
 				}
 			}
-			// Clear the IRQ flags.
-			r.SetRegister(0x12, 0xFF) // RegIrqFlags.
+			pollTimer.Reset(pollInterval)
+		case <-deferChan:
+			deferChan = nil
+			if r.rxOngoing && !r.rxInProgress() {
+				// The packet never completed.
+				r.rxOngoing = false
+			}
+			if radioFree() && (len(txWaiting) > 0 || len(r.jobWaiting) > 0) {
+				txWaiting = r.resume(txWaiting)
+			}
+		case job := <-r.jobQueue:
+			r.jobWaiting = append(r.jobWaiting, job)
+			if radioFree() {
+				txWaiting = r.resume(txWaiting)
+			}
 		case msg := <-r.txQueue:
 			txWaiting = append(txWaiting, msg) // txWaiting is a FIFO queue.
 			if len(txWaiting) > MAX_TXQUEUE_PILEUP {
@@ -512,22 +1172,18 @@ func (r *RFM95W) queueHandler() {
 				fmt.Printf("WARNING: queueHandler() dropping oldest messages, %d in queue.\n", len(txWaiting))
 				txWaiting = txWaiting[len(txWaiting)-MAX_TXQUEUE_PILEUP:]
 			}
-			if r.currentMode != RF95W_MODE_TX { // If we're currently in TX mode, let the current transmission finish.
-				if r.Debug {
-					fmt.Printf("queuehandler() starting new transmission.\n")
-				}
-				// Switch to transmit mode.
-				err := r.sendMessage(txWaiting[0])
-				if err != nil {
-					fmt.Printf("queueHandler() send message error: %s\n", err.Error())
-				} else {
-					txWaiting = txWaiting[1:] // Message was buffered to the radio successfully.
-				}
+			if radioFree() {
+				txWaiting = r.resume(txWaiting)
+				pollInterval = RF95W_POLL_MIN // Takes effect after the next poll.
 			}
 		case <-r.stopQueue:
 			if r.Debug {
 				fmt.Printf("queueHandler() received shutdown.\n")
 			}
+			for _, job := range r.jobWaiting {
+				job.done <- errors.New("queueHandler(): stopped.")
+			}
+			r.jobWaiting = nil
 			r.SetMode(RF95W_MODE_STDBY)
 			return
 		}
@@ -540,19 +1196,34 @@ func (r *RFM95W) queueHandler() {
 	 This is called when all of the parameters and settings have been set.
 */
 func (r *RFM95W) Start() {
-	go r.queueHandler()
+	r.mu_Queue.Lock()
+	defer r.mu_Queue.Unlock()
+	r.queueRunning = true
+	r.queueDone = make(chan struct{})
+	go r.queueHandler(r.queueDone)
 }
 
 /*
 	Stop().
-	 Stops the queue handler.
+	 Stops the queue handler and waits for it to exit, leaving the module in STDBY.
 	 This is called when we want to change settings.
 */
 func (r *RFM95W) Stop() {
 	if r.Debug {
 		fmt.Printf("Stopping queue thread...\n")
 	}
-	r.stopQueue <- 1
+	r.mu_Queue.Lock()
+	queueDone := r.queueDone
+	r.mu_Queue.Unlock()
+	if queueDone == nil {
+		return // Never started.
+	}
+	select {
+	case r.stopQueue <- 1:
+	case <-queueDone:
+	}
+	// Wait for queueHandler to put the module in STDBY and exit.
+	<-queueDone
 }
 
 /*
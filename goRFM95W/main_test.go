@@ -0,0 +1,280 @@
+package goRFM95W
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// newTestModule sets up a module on an SX1276Emulator. It is stopped and closed at the end of the test.
+func newTestModule(t *testing.T, params *RFM95W_Params) (*RFM95W, *SX1276Emulator) {
+	t.Helper()
+	e := NewSX1276Emulator()
+	pins := RF95W_EMULATOR_PINS
+	r, err := New(params, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins, SettleTime: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New(): %s", err)
+	}
+	t.Cleanup(func() {
+		r.Stop()
+		r.Close()
+	})
+	return r, e
+}
+
+// waitFor polls cond until it is true, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s.", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startReceiving starts the queue handler and waits for LoRa RXCONTINUOUS.
+func startReceiving(t *testing.T, r *RFM95W, e *SX1276Emulator) {
+	t.Helper()
+	r.Start()
+	waitFor(t, "RXCONTINUOUS", func() bool { return e.Mode()&^RF95W_MODE_LF == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+}
+
+// waitTransmitted waits for n packets to be transmitted and returns them.
+func waitTransmitted(t *testing.T, e *SX1276Emulator, n int) [][]byte {
+	t.Helper()
+	var tx [][]byte
+	waitFor(t, "transmission", func() bool {
+		tx = append(tx, e.Transmitted()...)
+		return len(tx) >= n
+	})
+	return tx
+}
+
+// waitReceived waits for n messages in RecvBuf and returns them.
+func waitReceived(t *testing.T, r *RFM95W, n int) []RFM95W_Message {
+	t.Helper()
+	var msgs []RFM95W_Message
+	waitFor(t, "reception", func() bool {
+		msgs = append(msgs, r.FlushRXBuffer()...)
+		return len(msgs) >= n
+	})
+	return msgs
+}
+
+func TestSendMessage(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	startReceiving(t, r, e)
+
+	if err := r.Send([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Send([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	tx := waitTransmitted(t, e, 2)
+	if len(tx) != 2 || !bytes.Equal(tx[0], []byte("hello")) || !bytes.Equal(tx[1], []byte("world")) {
+		t.Fatalf("Transmitted %q, expected hello and world.", tx)
+	}
+	// Back to receiving, with DIO0 on RxDone.
+	waitFor(t, "RXCONTINUOUS after TX", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+	if m := e.Register(RF95W_REG_DIOMAPPING1) >> 6; m != RF95W_DIO0_RXDONE {
+		t.Fatalf("DIO0 mapping %d, expected RxDone.", m)
+	}
+	if r.LastTXTime <= 0 {
+		t.Fatalf("LastTXTime %s.", r.LastTXTime)
+	}
+}
+
+func TestSendMessageTooLong(t *testing.T) {
+	r, _ := newTestModule(t, nil)
+	if err := r.Send(make([]byte, 256)); err == nil {
+		t.Fatal("256 byte message accepted.")
+	}
+}
+
+func TestReceive(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	startReceiving(t, r, e)
+
+	if err := e.Receive(EmulatorPacket{Payload: []byte("abc"), RSSI: -80, SNR: 7.25}); err != nil {
+		t.Fatal(err)
+	}
+	msgs := waitReceived(t, r, 1)
+	if err := e.Receive(EmulatorPacket{Payload: []byte("defg"), RSSI: -110, SNR: -3}); err != nil {
+		t.Fatal(err)
+	}
+	msgs = append(msgs, waitReceived(t, r, 1)...)
+
+	m := msgs[0]
+	if string(m.Buf) != "abc" || m.RSSI != -80 || m.SNR != 7.25 || !m.CRCValid {
+		t.Fatalf("First message %+v.", m)
+	}
+	if m.Params.Frequency != r.settings.Frequency || m.Params.SpreadingFactor != r.settings.SpreadingFactor {
+		t.Fatalf("Message params %+v, expected %+v.", m.Params, r.settings)
+	}
+	m = msgs[1]
+	if string(m.Buf) != "defg" || m.RSSI != -110 || m.SNR != -3 || m.SignalRSSI != -113 {
+		t.Fatalf("Second message %+v.", m)
+	}
+	if flags := e.Register(RF95W_REG_IRQFLAGS); flags != 0 {
+		t.Fatalf("RegIrqFlags %02x not cleared.", flags)
+	}
+	if e.Mode() != RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS {
+		t.Fatalf("RegOpMode %02x after RX.", e.Mode())
+	}
+}
+
+func TestSetParams(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	startReceiving(t, r, e)
+
+	p := RFM95W_Params{Frequency: 868100000, Bandwidth: 125000, SpreadingFactor: 9, CodingRate: 7, PreambleLength: 12}
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	if v := e.Register(RF95W_REG_MODEMCONFIG1); v>>4 != 0x7 || (v>>1)&0x7 != 3 {
+		t.Fatalf("RegModemConfig1 %02x, expected 125 kHz and 4/7.", v)
+	}
+	if v := e.Register(RF95W_REG_MODEMCONFIG2); v>>4 != 9 {
+		t.Fatalf("RegModemConfig2 %02x, expected SF9.", v)
+	}
+	if e.Register(RF95W_REG_PREAMBLEMSB) != 0 || e.Register(RF95W_REG_PREAMBLELSB) != 12 {
+		t.Fatal("Preamble length not set.")
+	}
+	frf := uint32(e.Register(RF95W_REG_FRFMSB))<<16 | uint32(e.Register(RF95W_REG_FRFMID))<<8 | uint32(e.Register(RF95W_REG_FRFLSB))
+	if frf != 0xD90666 {
+		t.Fatalf("RegFrf %06x, expected d90666.", frf)
+	}
+	if r.settings.Bandwidth != 125000 || r.settings.SpreadingFactor != 9 || r.settings.CodingRate != 7 {
+		t.Fatalf("Settings %+v.", r.settings)
+	}
+	if e.Mode() != RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS {
+		t.Fatalf("RegOpMode %02x, expected RXCONTINUOUS after SetParams.", e.Mode())
+	}
+
+	// Invalid parameters are rejected before anything is written.
+	bad := p
+	bad.SpreadingFactor = 13
+	if err := r.SetParams(bad); err == nil {
+		t.Fatal("SF13 accepted.")
+	}
+	if v := e.Register(RF95W_REG_MODEMCONFIG2); v>>4 != 9 || r.settings.SpreadingFactor != 9 {
+		t.Fatalf("RegModemConfig2 %02x changed by invalid parameters.", v)
+	}
+}
+
+func TestDetectChip(t *testing.T) {
+	r, _ := newTestModule(t, nil)
+	if r.ChipVersion != RF95W_CHIP_VERSION {
+		t.Fatalf("ChipVersion %02x.", r.ChipVersion)
+	}
+
+	noReset := RF95W_EMULATOR_PINS
+	noReset.RESET = RFM95W_OptionalPin{}
+	e := NewSX1276Emulator()
+	e.SetRegister(RF95W_REG_VERSION, 0x22)
+	if _, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &noReset}); err == nil {
+		t.Fatal("Wrong chip accepted.")
+	} else if _, ok := err.(*WrongChipError); !ok {
+		t.Fatalf("Wrong chip: %s", err)
+	}
+
+	e = NewSX1276Emulator()
+	e.Stuck = true
+	if _, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &noReset}); err == nil {
+		t.Fatal("Stuck chip accepted.")
+	} else if _, ok := err.(*ChipStuckError); !ok {
+		t.Fatalf("Stuck chip: %s", err)
+	}
+}
+
+func TestDetectChipResetRecovery(t *testing.T) {
+	e := NewSX1276Emulator()
+	e.Stuck = true
+	pins := RF95W_EMULATOR_PINS
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins})
+	if err != nil {
+		t.Fatalf("Stuck chip not recovered by reset: %s", err)
+	}
+	defer r.Close()
+	if e.Mode()&RF95W_MODE_LORA == 0 {
+		t.Fatalf("RegOpMode %02x after recovery.", e.Mode())
+	}
+}
+
+func TestPolling(t *testing.T) {
+	e := NewSX1276Emulator()
+	e.TxDelay = 20 * time.Millisecond
+	pins := RF95W_EMULATOR_PINS
+	pins.DIO0 = RFM95W_OptionalPin{}
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins, SettleTime: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer r.Stop()
+	startReceiving(t, r, e)
+
+	if err := r.Send([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Send([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if tx := waitTransmitted(t, e, 2); len(tx) != 2 || string(tx[0]) != "a" || string(tx[1]) != "b" {
+		t.Fatalf("Transmitted %q.", tx)
+	}
+	waitFor(t, "RXCONTINUOUS after TX", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+	if err := e.Receive(EmulatorPacket{Payload: []byte("xyz"), RSSI: -50}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := waitReceived(t, r, 1); string(msgs[0].Buf) != "xyz" || msgs[0].RSSI != -50 {
+		t.Fatalf("Received %+v.", msgs)
+	}
+}
+
+func TestSetTXPower(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	// Default +17 dBm on PA_BOOST.
+	if e.Register(RF95W_REG_PACONFIG) != 0x8F || e.Register(RF95W_REG_PADAC) != 0x84 || e.Register(RF95W_REG_OCP) != 0x2B {
+		t.Fatalf("RegPaConfig %02x, RegPaDac %02x, RegOcp %02x.", e.Register(RF95W_REG_PACONFIG), e.Register(RF95W_REG_PADAC), e.Register(RF95W_REG_OCP))
+	}
+	// +20 dBm uses the high power DAC and a higher current limit.
+	if err := r.SetTXPower(20); err != nil {
+		t.Fatal(err)
+	}
+	if e.Register(RF95W_REG_PACONFIG) != 0x8F || e.Register(RF95W_REG_PADAC) != 0x87 || e.Register(RF95W_REG_OCP) != 0x31 {
+		t.Fatalf("RegPaConfig %02x, RegPaDac %02x, RegOcp %02x.", e.Register(RF95W_REG_PACONFIG), e.Register(RF95W_REG_PADAC), e.Register(RF95W_REG_OCP))
+	}
+	if err := r.SetTXPower(1); err == nil {
+		t.Fatal("+1 dBm accepted on PA_BOOST.")
+	}
+	// The power setting survives SetParams().
+	if err := r.SetParams(r.settings); err != nil {
+		t.Fatal(err)
+	}
+	if e.Register(RF95W_REG_PADAC) != 0x87 {
+		t.Fatalf("RegPaDac %02x after SetParams().", e.Register(RF95W_REG_PADAC))
+	}
+}
+
+func TestSetTXPowerRFO(t *testing.T) {
+	e := NewSX1276Emulator()
+	pins := RF95W_EMULATOR_PINS
+	r, err := New(nil, &RFM95W_Options{SPI: e, GPIO: e, Pins: &pins, UseRFO: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.SetTXPower(-2); err != nil {
+		t.Fatal(err)
+	}
+	if v := e.Register(RF95W_REG_PACONFIG); v != 0x02 {
+		t.Fatalf("RegPaConfig %02x, expected 02.", v)
+	}
+	if err := r.SetTXPower(20); err == nil {
+		t.Fatal("+20 dBm accepted on RFO.")
+	}
+}
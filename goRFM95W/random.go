@@ -0,0 +1,155 @@
+// Hardware random number generator.
+
+package goRFM95W
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	RF95W_RANDOM_BW          = 500000 // Hz. Receiver bandwidth while sampling, the noise is least correlated.
+	RF95W_RANDOM_INPUT_BYTES = 64     // Whitened bytes hashed into each 32 byte output block.
+	RF95W_RANDOM_MAX_PAIRS   = 4096   // Sample pairs per output block before giving up, about 1024 are needed.
+	// Wait before each RegRssiWideband read. The register updates much slower than it can be read over SPI, so
+	// back-to-back reads are correlated. 1 ms per sample, as in Semtech's reference driver.
+	RF95W_RANDOM_SAMPLE_INTERVAL = 1 * time.Millisecond
+)
+
+// Registers changed by startRandom(), saved and restored around each Read(). RegOpMode is restored last.
+var randomRegisters = []byte{RF95W_REG_MODEMCONFIG1, RF95W_REG_MODEMCONFIG2, RF95W_REG_IRQFLAGSMASK, RF95W_REG_OPMODE}
+
+/*
+	RFM95W_RandomReader.
+	 io.Reader returning random bytes generated from receiver noise. See RandomReader().
+*/
+
+type RFM95W_RandomReader struct {
+	r *RFM95W
+}
+
+/*
+	RandomReader().
+	 Returns an io.Reader of random bytes from the module. The LSB of RegRssiWideband, sampled in RXCONTINUOUS, is
+	 debiased with a von Neumann extractor and conditioned with SHA-256. Each Read() runs through queueHandler, so
+	 that it doesn't interrupt TX or a packet being received. The radio parameters are restored afterwards.
+	 Samples are taken RF95W_RANDOM_SAMPLE_INTERVAL apart so that they are independent, and each debiased bit is
+	 counted as one bit of entropy. Every 32 byte output block hashes 512 of them, so each output bit is backed by
+	 two. Reading is slow, about 2 s per 32 bytes, and TX waits meanwhile: use it to seed a CSPRNG.
+*/
+
+func (r *RFM95W) RandomReader() io.Reader {
+	return &RFM95W_RandomReader{r: r}
+}
+
+func (rr *RFM95W_RandomReader) Read(p []byte) (int, error) {
+	r := rr.r
+	if !r.isLoRa() {
+		return 0, errors.New("RandomReader: not in LoRa mode.")
+	}
+	n := 0
+	err := r.runJob(func() error {
+		r.mu_Send.Lock()
+		defer r.mu_Send.Unlock()
+
+		saved := make([]byte, len(randomRegisters))
+		for i, reg := range randomRegisters {
+			val, err := r.GetRegister(reg)
+			if err != nil {
+				return err
+			}
+			saved[i] = val
+		}
+		err := r.startRandom()
+		if err == nil {
+			for n < len(p) && err == nil {
+				var block []byte
+				block, err = r.randomBlock()
+				n += copy(p[n:], block)
+			}
+		}
+		// Back to the previous registers, in STDBY. Discard anything received meanwhile.
+		r.SetMode(RF95W_MODE_STDBY)
+		r.SetRegister(RF95W_REG_IRQFLAGS, 0xFF)
+		for i, reg := range randomRegisters {
+			val := saved[i]
+			if reg == RF95W_REG_OPMODE {
+				val = RF95W_FIELD_MODE.Set(val, RF95W_MODE_STDBY)
+			}
+			r.SetRegister(reg, val)
+		}
+		return err
+	})
+	return n, err
+}
+
+/*
+	startRandom().
+	 Switches to RXCONTINUOUS at RF95W_RANDOM_BW with all IRQs masked. Only Bw is written, settings is left
+	 alone.
+*/
+
+func (r *RFM95W) startRandom() error {
+	err := r.SetMode(RF95W_MODE_STDBY)
+	if err != nil {
+		return err
+	}
+	_, err = r.SetRegister(RF95W_REG_IRQFLAGSMASK, 0xFF)
+	if err != nil {
+		return err
+	}
+	err = r.SetField(RF95W_FIELD_BW, RFM95W_Bandwidths[RF95W_RANDOM_BW])
+	if err != nil {
+		return err
+	}
+	return r.SetMode(RF95W_MODE_RXCONTINUOUS)
+}
+
+/*
+	randomSample().
+	 Waits RF95W_RANDOM_SAMPLE_INTERVAL and returns the LSB of RegRssiWideband.
+*/
+
+func (r *RFM95W) randomSample() (byte, error) {
+	time.Sleep(RF95W_RANDOM_SAMPLE_INTERVAL)
+	val, err := r.GetRegister(RF95W_REG_RSSIWIDEBAND)
+	return val & 0x01, err
+}
+
+/*
+	randomBlock().
+	 Collects RF95W_RANDOM_INPUT_BYTES of debiased bits and returns their SHA-256 hash.
+*/
+
+func (r *RFM95W) randomBlock() ([]byte, error) {
+	in := make([]byte, 0, RF95W_RANDOM_INPUT_BYTES)
+	var cur byte
+	var nbits uint
+	for i := 0; i < RF95W_RANDOM_MAX_PAIRS && len(in) < RF95W_RANDOM_INPUT_BYTES; i++ {
+		a, err := r.randomSample()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.randomSample()
+		if err != nil {
+			return nil, err
+		}
+		// von Neumann: 01 -> 0, 10 -> 1, 00 and 11 are dropped.
+		if a == b {
+			continue
+		}
+		cur = cur<<1 | a
+		nbits++
+		if nbits == 8 {
+			in = append(in, cur)
+			cur, nbits = 0, 0
+		}
+	}
+	if len(in) < RF95W_RANDOM_INPUT_BYTES {
+		return nil, errors.New("RandomReader: not enough entropy from RegRssiWideband.")
+	}
+	sum := sha256.Sum256(in)
+	return sum[:], nil
+}
@@ -0,0 +1,48 @@
+package goRFM95W
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRandomReader(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	p := r.settings
+	p.Bandwidth = 125000
+	if err := r.SetParams(p); err != nil {
+		t.Fatal(err)
+	}
+	e.SetRegister(RF95W_REG_PACONFIG, 0x4F)
+	startReceiving(t, r, e)
+
+	// One output block: at least 512 samples, RF95W_RANDOM_SAMPLE_INTERVAL apart.
+	buf := make([]byte, 32)
+	start := time.Now()
+	if _, err := io.ReadFull(r.RandomReader(), buf); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 512*RF95W_RANDOM_SAMPLE_INTERVAL {
+		t.Fatalf("Read took %s, samples not spaced.", d)
+	}
+	if bytes.Equal(buf, make([]byte, 32)) {
+		t.Fatal("Read returned zeroes.")
+	}
+
+	// The radio parameters are restored and receiving resumes.
+	if r.settings.Bandwidth != 125000 || e.Register(RF95W_REG_MODEMCONFIG1)>>4 != 7 {
+		t.Fatalf("Bandwidth %d, RegModemConfig1 %02x after Read().", r.settings.Bandwidth, e.Register(RF95W_REG_MODEMCONFIG1))
+	}
+	// Only the registers changed for sampling are restored, nothing else is rewritten.
+	if v := e.Register(RF95W_REG_PACONFIG); v != 0x4F {
+		t.Fatalf("RegPaConfig %02x after Read().", v)
+	}
+	if v := e.Register(RF95W_REG_HIGHBWOPTIMIZE1); v != RF95W_HIGHBWOPTIMIZE1_OTHER {
+		t.Fatalf("RegHighBwOptimize1 %02x after Read().", v)
+	}
+	if v := e.Register(RF95W_REG_IRQFLAGSMASK); v != 0 {
+		t.Fatalf("RegIrqFlagsMask %02x after Read().", v)
+	}
+	waitFor(t, "RXCONTINUOUS after Read()", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+}
@@ -0,0 +1,687 @@
+// Register map, bitfield accessors and register dumps.
+
+package goRFM95W
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Register pages. 0x0D-0x3F hold different registers in LoRa and FSK/OOK mode.
+const (
+	RF95W_PAGE_COMMON = 0
+	RF95W_PAGE_LORA   = 1
+	RF95W_PAGE_FSK    = 2
+)
+
+// Common registers.
+const (
+	RF95W_REG_FIFO        = 0x00
+	RF95W_REG_OPMODE      = 0x01
+	RF95W_REG_BITRATEMSB  = 0x02 // FSK/OOK.
+	RF95W_REG_BITRATELSB  = 0x03 // FSK/OOK.
+	RF95W_REG_FDEVMSB     = 0x04 // FSK.
+	RF95W_REG_FDEVLSB     = 0x05 // FSK.
+	RF95W_REG_FRFMSB      = 0x06
+	RF95W_REG_FRFMID      = 0x07
+	RF95W_REG_FRFLSB      = 0x08
+	RF95W_REG_PACONFIG    = 0x09
+	RF95W_REG_PARAMP      = 0x0A
+	RF95W_REG_OCP         = 0x0B
+	RF95W_REG_LNA         = 0x0C
+	RF95W_REG_DIOMAPPING1 = 0x40
+	RF95W_REG_DIOMAPPING2 = 0x41
+	RF95W_REG_VERSION     = 0x42
+	RF95W_REG_PLLHOP      = 0x44 // FSK/OOK.
+	RF95W_REG_TCXO        = 0x4B
+	RF95W_REG_PADAC       = 0x4D
+	RF95W_REG_FORMERTEMP  = 0x5B
+	RF95W_REG_BITRATEFRAC = 0x5D // FSK/OOK.
+	RF95W_REG_AGCREF      = 0x61
+	RF95W_REG_AGCTHRESH1  = 0x62
+	RF95W_REG_AGCTHRESH2  = 0x63
+	RF95W_REG_AGCTHRESH3  = 0x64
+	RF95W_REG_PLL         = 0x70
+)
+
+// LoRa page registers.
+const (
+	RF95W_REG_FIFOADDRPTR         = 0x0D
+	RF95W_REG_FIFOTXBASEADDR      = 0x0E
+	RF95W_REG_FIFORXBASEADDR      = 0x0F
+	RF95W_REG_FIFORXCURRENTADDR   = 0x10
+	RF95W_REG_IRQFLAGSMASK        = 0x11
+	RF95W_REG_IRQFLAGS            = 0x12
+	RF95W_REG_RXNBBYTES           = 0x13
+	RF95W_REG_RXHEADERCNTVALUEMSB = 0x14
+	RF95W_REG_RXHEADERCNTVALUELSB = 0x15
+	RF95W_REG_RXPACKETCNTVALUEMSB = 0x16
+	RF95W_REG_RXPACKETCNTVALUELSB = 0x17
+	RF95W_REG_MODEMSTAT           = 0x18
+	RF95W_REG_PKTSNRVALUE         = 0x19
+	RF95W_REG_PKTRSSIVALUE        = 0x1A
+	RF95W_REG_RSSIVALUE           = 0x1B
+	RF95W_REG_HOPCHANNEL          = 0x1C
+	RF95W_REG_MODEMCONFIG1        = 0x1D
+	RF95W_REG_MODEMCONFIG2        = 0x1E
+	RF95W_REG_SYMBTIMEOUTLSB      = 0x1F
+	RF95W_REG_PREAMBLEMSB         = 0x20
+	RF95W_REG_PREAMBLELSB         = 0x21
+	RF95W_REG_PAYLOADLENGTH       = 0x22
+	RF95W_REG_MAXPAYLOADLENGTH    = 0x23
+	RF95W_REG_HOPPERIOD           = 0x24
+	RF95W_REG_FIFORXBYTEADDR      = 0x25
+	RF95W_REG_MODEMCONFIG3        = 0x26
+	RF95W_REG_PPMCORRECTION       = 0x27
+	RF95W_REG_FEIMSB              = 0x28
+	RF95W_REG_FEIMID              = 0x29
+	RF95W_REG_FEILSB              = 0x2A
+	RF95W_REG_RSSIWIDEBAND        = 0x2C
+	RF95W_REG_IFFREQ2             = 0x2F
+	RF95W_REG_IFFREQ1             = 0x30
+	RF95W_REG_DETECTOPTIMIZE      = 0x31
+	RF95W_REG_INVERTIQ            = 0x33
+	RF95W_REG_HIGHBWOPTIMIZE1     = 0x36
+	RF95W_REG_DETECTIONTHRESHOLD  = 0x37
+	RF95W_REG_SYNCWORD            = 0x39
+	RF95W_REG_HIGHBWOPTIMIZE2     = 0x3A
+	RF95W_REG_INVERTIQ2           = 0x3B
+)
+
+// FSK/OOK page registers.
+const (
+	RF95W_REG_FSK_RXCONFIG       = 0x0D
+	RF95W_REG_FSK_RSSICONFIG     = 0x0E
+	RF95W_REG_FSK_RSSICOLLISION  = 0x0F
+	RF95W_REG_FSK_RSSITHRESH     = 0x10
+	RF95W_REG_FSK_RSSIVALUE      = 0x11
+	RF95W_REG_FSK_RXBW           = 0x12
+	RF95W_REG_FSK_AFCBW          = 0x13
+	RF95W_REG_FSK_OOKPEAK        = 0x14
+	RF95W_REG_FSK_OOKFIX         = 0x15
+	RF95W_REG_FSK_OOKAVG         = 0x16
+	RF95W_REG_FSK_AFCFEI         = 0x1A
+	RF95W_REG_FSK_AFCMSB         = 0x1B
+	RF95W_REG_FSK_AFCLSB         = 0x1C
+	RF95W_REG_FSK_FEIMSB         = 0x1D
+	RF95W_REG_FSK_FEILSB         = 0x1E
+	RF95W_REG_FSK_PREAMBLEDETECT = 0x1F
+	RF95W_REG_FSK_RXTIMEOUT1     = 0x20
+	RF95W_REG_FSK_RXTIMEOUT2     = 0x21
+	RF95W_REG_FSK_RXTIMEOUT3     = 0x22
+	RF95W_REG_FSK_RXDELAY        = 0x23
+	RF95W_REG_FSK_OSC            = 0x24
+	RF95W_REG_FSK_PREAMBLEMSB    = 0x25
+	RF95W_REG_FSK_PREAMBLELSB    = 0x26
+	RF95W_REG_FSK_SYNCCONFIG     = 0x27
+	RF95W_REG_FSK_SYNCVALUE1     = 0x28 // RegSyncValue1-8: 0x28-0x2F.
+	RF95W_REG_FSK_PACKETCONFIG1  = 0x30
+	RF95W_REG_FSK_PACKETCONFIG2  = 0x31
+	RF95W_REG_FSK_PAYLOADLENGTH  = 0x32
+	RF95W_REG_FSK_NODEADRS       = 0x33
+	RF95W_REG_FSK_BROADCASTADRS  = 0x34
+	RF95W_REG_FSK_FIFOTHRESH     = 0x35
+	RF95W_REG_FSK_SEQCONFIG1     = 0x36
+	RF95W_REG_FSK_SEQCONFIG2     = 0x37
+	RF95W_REG_FSK_TIMERRESOL     = 0x38
+	RF95W_REG_FSK_TIMER1COEF     = 0x39
+	RF95W_REG_FSK_TIMER2COEF     = 0x3A
+	RF95W_REG_FSK_IMAGECAL       = 0x3B
+	RF95W_REG_FSK_TEMP           = 0x3C
+	RF95W_REG_FSK_LOWBAT         = 0x3D
+	RF95W_REG_FSK_IRQFLAGS1      = 0x3E
+	RF95W_REG_FSK_IRQFLAGS2      = 0x3F
+)
+
+/*
+	RFM95W_Field.
+	 A bitfield within a register: Width bits starting at bit Shift. Values optionally names the field values,
+	 for DumpRegisters().
+*/
+
+type RFM95W_Field struct {
+	Name   string
+	Reg    byte
+	Page   int
+	Shift  uint
+	Width  uint
+	Values map[byte]string
+}
+
+// Named bitfields used by the driver.
+var (
+	RF95W_FIELD_LONGRANGEMODE      = &RFM95W_Field{"LongRangeMode", RF95W_REG_OPMODE, RF95W_PAGE_COMMON, 7, 1, map[byte]string{0: "FSK/OOK", 1: "LoRa"}}
+	RF95W_FIELD_ACCESSSHAREDREG    = &RFM95W_Field{"AccessSharedReg", RF95W_REG_OPMODE, RF95W_PAGE_LORA, 6, 1, nil}
+	RF95W_FIELD_MODULATIONTYPE     = &RFM95W_Field{"ModulationType", RF95W_REG_OPMODE, RF95W_PAGE_FSK, 5, 2, map[byte]string{0: "FSK", 1: "OOK"}}
+	RF95W_FIELD_LOWFREQUENCYMODEON = &RFM95W_Field{"LowFrequencyModeOn", RF95W_REG_OPMODE, RF95W_PAGE_COMMON, 3, 1, nil}
+	RF95W_FIELD_MODE               = &RFM95W_Field{"Mode", RF95W_REG_OPMODE, RF95W_PAGE_COMMON, 0, 3, map[byte]string{
+		RF95W_MODE_SLEEP:        "SLEEP",
+		RF95W_MODE_STDBY:        "STDBY",
+		RF95W_MODE_FSTX:         "FSTX",
+		RF95W_MODE_TX:           "TX",
+		RF95W_MODE_FSRX:         "FSRX",
+		RF95W_MODE_RXCONTINUOUS: "RXCONTINUOUS",
+		RF95W_MODE_RXSINGLE:     "RXSINGLE",
+		RF95W_MODE_CAD:          "CAD",
+	}}
+
+	RF95W_FIELD_PASELECT    = &RFM95W_Field{"PaSelect", RF95W_REG_PACONFIG, RF95W_PAGE_COMMON, 7, 1, map[byte]string{0: "RFO", 1: "PA_BOOST"}}
+	RF95W_FIELD_MAXPOWER    = &RFM95W_Field{"MaxPower", RF95W_REG_PACONFIG, RF95W_PAGE_COMMON, 4, 3, nil}
+	RF95W_FIELD_OUTPUTPOWER = &RFM95W_Field{"OutputPower", RF95W_REG_PACONFIG, RF95W_PAGE_COMMON, 0, 4, nil}
+	RF95W_FIELD_OCPON       = &RFM95W_Field{"OcpOn", RF95W_REG_OCP, RF95W_PAGE_COMMON, 5, 1, nil}
+	RF95W_FIELD_OCPTRIM     = &RFM95W_Field{"OcpTrim", RF95W_REG_OCP, RF95W_PAGE_COMMON, 0, 5, nil}
+	RF95W_FIELD_LNAGAIN     = &RFM95W_Field{"LnaGain", RF95W_REG_LNA, RF95W_PAGE_COMMON, 5, 3, nil}
+	RF95W_FIELD_LNABOOSTLF  = &RFM95W_Field{"LnaBoostLf", RF95W_REG_LNA, RF95W_PAGE_COMMON, 3, 2, nil}
+	RF95W_FIELD_LNABOOSTHF  = &RFM95W_Field{"LnaBoostHf", RF95W_REG_LNA, RF95W_PAGE_COMMON, 0, 2, map[byte]string{0: "default", 3: "boost"}}
+
+	RF95W_FIELD_DIO0MAPPING       = &RFM95W_Field{"Dio0Mapping", RF95W_REG_DIOMAPPING1, RF95W_PAGE_COMMON, 6, 2, nil}
+	RF95W_FIELD_DIO1MAPPING       = &RFM95W_Field{"Dio1Mapping", RF95W_REG_DIOMAPPING1, RF95W_PAGE_COMMON, 4, 2, nil}
+	RF95W_FIELD_DIO2MAPPING       = &RFM95W_Field{"Dio2Mapping", RF95W_REG_DIOMAPPING1, RF95W_PAGE_COMMON, 2, 2, nil}
+	RF95W_FIELD_DIO3MAPPING       = &RFM95W_Field{"Dio3Mapping", RF95W_REG_DIOMAPPING1, RF95W_PAGE_COMMON, 0, 2, nil}
+	RF95W_FIELD_DIO4MAPPING       = &RFM95W_Field{"Dio4Mapping", RF95W_REG_DIOMAPPING2, RF95W_PAGE_COMMON, 6, 2, nil}
+	RF95W_FIELD_DIO5MAPPING       = &RFM95W_Field{"Dio5Mapping", RF95W_REG_DIOMAPPING2, RF95W_PAGE_COMMON, 4, 2, nil}
+	RF95W_FIELD_MAPPREAMBLEDETECT = &RFM95W_Field{"MapPreambleDetect", RF95W_REG_DIOMAPPING2, RF95W_PAGE_COMMON, 0, 1, nil}
+	RF95W_FIELD_PADAC             = &RFM95W_Field{"PaDac", RF95W_REG_PADAC, RF95W_PAGE_COMMON, 0, 3, map[byte]string{0x04: "default", 0x07: "+20 dBm"}}
+
+	RF95W_FIELD_RXCODINGRATE         = &RFM95W_Field{"RxCodingRate", RF95W_REG_MODEMSTAT, RF95W_PAGE_LORA, 5, 3, codingRateNames}
+	RF95W_FIELD_RXONGOING            = &RFM95W_Field{"RxOnGoing", RF95W_REG_MODEMSTAT, RF95W_PAGE_LORA, 2, 1, nil}
+	RF95W_FIELD_CRCONPAYLOAD         = &RFM95W_Field{"CrcOnPayload", RF95W_REG_HOPCHANNEL, RF95W_PAGE_LORA, 6, 1, nil}
+	RF95W_FIELD_FHSSPRESENTCHANNEL   = &RFM95W_Field{"FhssPresentChannel", RF95W_REG_HOPCHANNEL, RF95W_PAGE_LORA, 0, 6, nil}
+	RF95W_FIELD_BW                   = &RFM95W_Field{"Bw", RF95W_REG_MODEMCONFIG1, RF95W_PAGE_LORA, 4, 4, bandwidthNames}
+	RF95W_FIELD_CODINGRATE           = &RFM95W_Field{"CodingRate", RF95W_REG_MODEMCONFIG1, RF95W_PAGE_LORA, 1, 3, codingRateNames}
+	RF95W_FIELD_IMPLICITHEADERMODEON = &RFM95W_Field{"ImplicitHeaderModeOn", RF95W_REG_MODEMCONFIG1, RF95W_PAGE_LORA, 0, 1, nil}
+	RF95W_FIELD_SPREADINGFACTOR      = &RFM95W_Field{"SpreadingFactor", RF95W_REG_MODEMCONFIG2, RF95W_PAGE_LORA, 4, 4, nil}
+	RF95W_FIELD_TXCONTINUOUSMODE     = &RFM95W_Field{"TxContinuousMode", RF95W_REG_MODEMCONFIG2, RF95W_PAGE_LORA, 3, 1, nil}
+	RF95W_FIELD_RXPAYLOADCRCON       = &RFM95W_Field{"RxPayloadCrcOn", RF95W_REG_MODEMCONFIG2, RF95W_PAGE_LORA, 2, 1, nil}
+	RF95W_FIELD_SYMBTIMEOUTMSB       = &RFM95W_Field{"SymbTimeout(9:8)", RF95W_REG_MODEMCONFIG2, RF95W_PAGE_LORA, 0, 2, nil}
+	RF95W_FIELD_LOWDATARATEOPTIMIZE  = &RFM95W_Field{"LowDataRateOptimize", RF95W_REG_MODEMCONFIG3, RF95W_PAGE_LORA, 3, 1, nil}
+	RF95W_FIELD_AGCAUTOON            = &RFM95W_Field{"AgcAutoOn", RF95W_REG_MODEMCONFIG3, RF95W_PAGE_LORA, 2, 1, nil}
+	RF95W_FIELD_AUTOMATICIFON        = &RFM95W_Field{"AutomaticIFOn", RF95W_REG_DETECTOPTIMIZE, RF95W_PAGE_LORA, 7, 1, nil}
+	RF95W_FIELD_DETECTIONOPTIMIZE    = &RFM95W_Field{"DetectionOptimize", RF95W_REG_DETECTOPTIMIZE, RF95W_PAGE_LORA, 0, 3, map[byte]string{0x03: "SF7-12", 0x05: "SF6"}}
+	RF95W_FIELD_INVERTIQRX           = &RFM95W_Field{"InvertIQRX", RF95W_REG_INVERTIQ, RF95W_PAGE_LORA, 6, 1, nil}
+	RF95W_FIELD_INVERTIQTX           = &RFM95W_Field{"InvertIQTX", RF95W_REG_INVERTIQ, RF95W_PAGE_LORA, 0, 1, nil}
+
+	RF95W_FIELD_IMAGECALSTART   = &RFM95W_Field{"ImageCalStart", RF95W_REG_FSK_IMAGECAL, RF95W_PAGE_FSK, 6, 1, nil}
+	RF95W_FIELD_IMAGECALRUNNING = &RFM95W_Field{"ImageCalRunning", RF95W_REG_FSK_IMAGECAL, RF95W_PAGE_FSK, 5, 1, nil}
+	RF95W_FIELD_TEMPMONITOROFF  = &RFM95W_Field{"TempMonitorOff", RF95W_REG_FSK_IMAGECAL, RF95W_PAGE_FSK, 0, 1, nil}
+
+	RF95W_FIELD_MODULATIONSHAPING = &RFM95W_Field{"ModulationShaping", RF95W_REG_PARAMP, RF95W_PAGE_FSK, 5, 2, nil}
+	RF95W_FIELD_BITSYNCON         = &RFM95W_Field{"BitSyncOn", RF95W_REG_FSK_OOKPEAK, RF95W_PAGE_FSK, 5, 1, nil}
+	RF95W_FIELD_OOKTHRESHTYPE     = &RFM95W_Field{"OokThreshType", RF95W_REG_FSK_OOKPEAK, RF95W_PAGE_FSK, 3, 2, map[byte]string{0: "fixed", 1: "peak", 2: "average"}}
+	RF95W_FIELD_RXBWMANT          = &RFM95W_Field{"RxBwMant", RF95W_REG_FSK_RXBW, RF95W_PAGE_FSK, 3, 2, map[byte]string{0: "16", 1: "20", 2: "24"}}
+	RF95W_FIELD_RXBWEXP           = &RFM95W_Field{"RxBwExp", RF95W_REG_FSK_RXBW, RF95W_PAGE_FSK, 0, 3, nil}
+	RF95W_FIELD_AUTORESTARTRXMODE = &RFM95W_Field{"AutoRestartRxMode", RF95W_REG_FSK_SYNCCONFIG, RF95W_PAGE_FSK, 6, 2, map[byte]string{0: "off", 1: "on", 2: "on, wait for PLL lock"}}
+	RF95W_FIELD_SYNCON            = &RFM95W_Field{"SyncOn", RF95W_REG_FSK_SYNCCONFIG, RF95W_PAGE_FSK, 4, 1, nil}
+	RF95W_FIELD_SYNCSIZE          = &RFM95W_Field{"SyncSize", RF95W_REG_FSK_SYNCCONFIG, RF95W_PAGE_FSK, 0, 3, nil}
+	RF95W_FIELD_PACKETFORMAT      = &RFM95W_Field{"PacketFormat", RF95W_REG_FSK_PACKETCONFIG1, RF95W_PAGE_FSK, 7, 1, map[byte]string{0: "fixed", 1: "variable"}}
+	RF95W_FIELD_DCFREE            = &RFM95W_Field{"DcFree", RF95W_REG_FSK_PACKETCONFIG1, RF95W_PAGE_FSK, 5, 2, map[byte]string{0: "none", 1: "Manchester", 2: "whitening"}}
+	RF95W_FIELD_CRCON             = &RFM95W_Field{"CrcOn", RF95W_REG_FSK_PACKETCONFIG1, RF95W_PAGE_FSK, 4, 1, nil}
+	RF95W_FIELD_CRCAUTOCLEAROFF   = &RFM95W_Field{"CrcAutoClearOff", RF95W_REG_FSK_PACKETCONFIG1, RF95W_PAGE_FSK, 3, 1, nil}
+	RF95W_FIELD_ADDRESSFILTERING  = &RFM95W_Field{"AddressFiltering", RF95W_REG_FSK_PACKETCONFIG1, RF95W_PAGE_FSK, 1, 2, map[byte]string{0: "off", 1: "node", 2: "node or broadcast"}}
+	RF95W_FIELD_DATAMODE          = &RFM95W_Field{"DataMode", RF95W_REG_FSK_PACKETCONFIG2, RF95W_PAGE_FSK, 6, 1, map[byte]string{0: "continuous", 1: "packet"}}
+	RF95W_FIELD_PAYLOADLENGTHMSB  = &RFM95W_Field{"PayloadLength(10:8)", RF95W_REG_FSK_PACKETCONFIG2, RF95W_PAGE_FSK, 0, 3, nil}
+	RF95W_FIELD_TXSTARTCONDITION  = &RFM95W_Field{"TxStartCondition", RF95W_REG_FSK_FIFOTHRESH, RF95W_PAGE_FSK, 7, 1, map[byte]string{0: "FifoLevel", 1: "FifoEmpty cleared"}}
+)
+
+var bandwidthNames = map[byte]string{
+	0x0: "7.8 kHz",
+	0x1: "10.4 kHz",
+	0x2: "15.6 kHz",
+	0x3: "20.8 kHz",
+	0x4: "31.25 kHz",
+	0x5: "41.7 kHz",
+	0x6: "62.5 kHz",
+	0x7: "125 kHz",
+	0x8: "250 kHz",
+	0x9: "500 kHz",
+}
+
+var codingRateNames = map[byte]string{
+	0x1: "4/5",
+	0x2: "4/6",
+	0x3: "4/7",
+	0x4: "4/8",
+}
+
+// Shorthands for the fields in RFM95W_Registers that the driver does not refer to by name. regFlags() returns
+// one-bit fields named from bit 7 down, "" skips a bit.
+func regField(name string, reg byte, page int, shift, width uint) *RFM95W_Field {
+	return &RFM95W_Field{Name: name, Reg: reg, Page: page, Shift: shift, Width: width}
+}
+
+func regFlags(reg byte, page int, names ...string) []*RFM95W_Field {
+	ret := make([]*RFM95W_Field, 0, len(names))
+	for i, name := range names {
+		if name != "" {
+			ret = append(ret, regField(name, reg, page, uint(7-i), 1))
+		}
+	}
+	return ret
+}
+
+/*
+	RFM95W_Register.
+	 An entry in the register map. Registers without Fields are decoded as a single value.
+*/
+
+type RFM95W_Register struct {
+	Addr   byte
+	Name   string
+	Page   int
+	Fields []*RFM95W_Field
+}
+
+// Page shorthands for RFM95W_Registers.
+const (
+	pageCommon = RF95W_PAGE_COMMON
+	pageLoRa   = RF95W_PAGE_LORA
+	pageFSK    = RF95W_PAGE_FSK
+)
+
+// All registers from the SX1276 datasheet, except RegFifo. In address order, the LoRa page before the FSK page.
+var RFM95W_Registers = []RFM95W_Register{
+	{RF95W_REG_OPMODE, "RegOpMode", pageCommon, []*RFM95W_Field{RF95W_FIELD_LONGRANGEMODE, RF95W_FIELD_ACCESSSHAREDREG, RF95W_FIELD_MODULATIONTYPE, RF95W_FIELD_LOWFREQUENCYMODEON, RF95W_FIELD_MODE}},
+	{RF95W_REG_BITRATEMSB, "RegBitrateMsb", pageCommon, nil},
+	{RF95W_REG_BITRATELSB, "RegBitrateLsb", pageCommon, nil},
+	{RF95W_REG_FDEVMSB, "RegFdevMsb", pageCommon, []*RFM95W_Field{regField("Fdev(13:8)", RF95W_REG_FDEVMSB, pageFSK, 0, 6)}},
+	{RF95W_REG_FDEVLSB, "RegFdevLsb", pageCommon, nil},
+	{RF95W_REG_FRFMSB, "RegFrfMsb", pageCommon, nil},
+	{RF95W_REG_FRFMID, "RegFrfMid", pageCommon, nil},
+	{RF95W_REG_FRFLSB, "RegFrfLsb", pageCommon, nil},
+	{RF95W_REG_PACONFIG, "RegPaConfig", pageCommon, []*RFM95W_Field{RF95W_FIELD_PASELECT, RF95W_FIELD_MAXPOWER, RF95W_FIELD_OUTPUTPOWER}},
+	{RF95W_REG_PARAMP, "RegPaRamp", pageCommon, []*RFM95W_Field{RF95W_FIELD_MODULATIONSHAPING, regField("PaRamp", RF95W_REG_PARAMP, pageCommon, 0, 4)}},
+	{RF95W_REG_OCP, "RegOcp", pageCommon, []*RFM95W_Field{RF95W_FIELD_OCPON, RF95W_FIELD_OCPTRIM}},
+	{RF95W_REG_LNA, "RegLna", pageCommon, []*RFM95W_Field{RF95W_FIELD_LNAGAIN, RF95W_FIELD_LNABOOSTLF, RF95W_FIELD_LNABOOSTHF}},
+
+	{RF95W_REG_FIFOADDRPTR, "RegFifoAddrPtr", pageLoRa, nil},
+	{RF95W_REG_FIFOTXBASEADDR, "RegFifoTxBaseAddr", pageLoRa, nil},
+	{RF95W_REG_FIFORXBASEADDR, "RegFifoRxBaseAddr", pageLoRa, nil},
+	{RF95W_REG_FIFORXCURRENTADDR, "RegFifoRxCurrentAddr", pageLoRa, nil},
+	{RF95W_REG_IRQFLAGSMASK, "RegIrqFlagsMask", pageLoRa, regFlags(RF95W_REG_IRQFLAGSMASK, pageLoRa, "RxTimeoutMask", "RxDoneMask", "PayloadCrcErrorMask", "ValidHeaderMask", "TxDoneMask", "CadDoneMask", "FhssChangeChannelMask", "CadDetectedMask")},
+	{RF95W_REG_IRQFLAGS, "RegIrqFlags", pageLoRa, regFlags(RF95W_REG_IRQFLAGS, pageLoRa, "RxTimeout", "RxDone", "PayloadCrcError", "ValidHeader", "TxDone", "CadDone", "FhssChangeChannel", "CadDetected")},
+	{RF95W_REG_RXNBBYTES, "RegRxNbBytes", pageLoRa, nil},
+	{RF95W_REG_RXHEADERCNTVALUEMSB, "RegRxHeaderCntValueMsb", pageLoRa, nil},
+	{RF95W_REG_RXHEADERCNTVALUELSB, "RegRxHeaderCntValueLsb", pageLoRa, nil},
+	{RF95W_REG_RXPACKETCNTVALUEMSB, "RegRxPacketCntValueMsb", pageLoRa, nil},
+	{RF95W_REG_RXPACKETCNTVALUELSB, "RegRxPacketCntValueLsb", pageLoRa, nil},
+	{RF95W_REG_MODEMSTAT, "RegModemStat", pageLoRa, append([]*RFM95W_Field{RF95W_FIELD_RXCODINGRATE}, regFlags(RF95W_REG_MODEMSTAT, pageLoRa, "", "", "", "ModemClear", "HeaderInfoValid", "RxOnGoing", "SignalSynchronized", "SignalDetected")...)},
+	{RF95W_REG_PKTSNRVALUE, "RegPktSnrValue", pageLoRa, nil},
+	{RF95W_REG_PKTRSSIVALUE, "RegPktRssiValue", pageLoRa, nil},
+	{RF95W_REG_RSSIVALUE, "RegRssiValue", pageLoRa, nil},
+	{RF95W_REG_HOPCHANNEL, "RegHopChannel", pageLoRa, []*RFM95W_Field{regField("PllTimeout", RF95W_REG_HOPCHANNEL, pageLoRa, 7, 1), RF95W_FIELD_CRCONPAYLOAD, RF95W_FIELD_FHSSPRESENTCHANNEL}},
+	{RF95W_REG_MODEMCONFIG1, "RegModemConfig1", pageLoRa, []*RFM95W_Field{RF95W_FIELD_BW, RF95W_FIELD_CODINGRATE, RF95W_FIELD_IMPLICITHEADERMODEON}},
+	{RF95W_REG_MODEMCONFIG2, "RegModemConfig2", pageLoRa, []*RFM95W_Field{RF95W_FIELD_SPREADINGFACTOR, RF95W_FIELD_TXCONTINUOUSMODE, RF95W_FIELD_RXPAYLOADCRCON, RF95W_FIELD_SYMBTIMEOUTMSB}},
+	{RF95W_REG_SYMBTIMEOUTLSB, "RegSymbTimeoutLsb", pageLoRa, nil},
+	{RF95W_REG_PREAMBLEMSB, "RegPreambleMsb", pageLoRa, nil},
+	{RF95W_REG_PREAMBLELSB, "RegPreambleLsb", pageLoRa, nil},
+	{RF95W_REG_PAYLOADLENGTH, "RegPayloadLength", pageLoRa, nil},
+	{RF95W_REG_MAXPAYLOADLENGTH, "RegMaxPayloadLength", pageLoRa, nil},
+	{RF95W_REG_HOPPERIOD, "RegHopPeriod", pageLoRa, nil},
+	{RF95W_REG_FIFORXBYTEADDR, "RegFifoRxByteAddr", pageLoRa, nil},
+	{RF95W_REG_MODEMCONFIG3, "RegModemConfig3", pageLoRa, []*RFM95W_Field{RF95W_FIELD_LOWDATARATEOPTIMIZE, RF95W_FIELD_AGCAUTOON}},
+	{RF95W_REG_PPMCORRECTION, "RegPpmCorrection", pageLoRa, nil},
+	{RF95W_REG_FEIMSB, "RegFeiMsb", pageLoRa, []*RFM95W_Field{regField("FreqError(19:16)", RF95W_REG_FEIMSB, pageLoRa, 0, 4)}},
+	{RF95W_REG_FEIMID, "RegFeiMid", pageLoRa, nil},
+	{RF95W_REG_FEILSB, "RegFeiLsb", pageLoRa, nil},
+	{RF95W_REG_RSSIWIDEBAND, "RegRssiWideband", pageLoRa, nil},
+	{RF95W_REG_IFFREQ2, "RegIfFreq2", pageLoRa, nil},
+	{RF95W_REG_IFFREQ1, "RegIfFreq1", pageLoRa, nil},
+	{RF95W_REG_DETECTOPTIMIZE, "RegDetectOptimize", pageLoRa, []*RFM95W_Field{RF95W_FIELD_AUTOMATICIFON, RF95W_FIELD_DETECTIONOPTIMIZE}},
+	{RF95W_REG_INVERTIQ, "RegInvertIQ", pageLoRa, []*RFM95W_Field{RF95W_FIELD_INVERTIQRX, RF95W_FIELD_INVERTIQTX}},
+	{RF95W_REG_HIGHBWOPTIMIZE1, "RegHighBwOptimize1", pageLoRa, nil},
+	{RF95W_REG_DETECTIONTHRESHOLD, "RegDetectionThreshold", pageLoRa, nil},
+	{RF95W_REG_SYNCWORD, "RegSyncWord", pageLoRa, nil},
+	{RF95W_REG_HIGHBWOPTIMIZE2, "RegHighBwOptimize2", pageLoRa, nil},
+	{RF95W_REG_INVERTIQ2, "RegInvertIQ2", pageLoRa, nil},
+
+	{RF95W_REG_FSK_RXCONFIG, "RegRxConfig", pageFSK, append(regFlags(RF95W_REG_FSK_RXCONFIG, pageFSK, "RestartRxOnCollision", "RestartRxWithoutPllLock", "RestartRxWithPllLock", "AfcAutoOn", "AgcAutoOn"), regField("RxTrigger", RF95W_REG_FSK_RXCONFIG, pageFSK, 0, 3))},
+	{RF95W_REG_FSK_RSSICONFIG, "RegRssiConfig", pageFSK, []*RFM95W_Field{regField("RssiOffset", RF95W_REG_FSK_RSSICONFIG, pageFSK, 3, 5), regField("RssiSmoothing", RF95W_REG_FSK_RSSICONFIG, pageFSK, 0, 3)}},
+	{RF95W_REG_FSK_RSSICOLLISION, "RegRssiCollision", pageFSK, nil},
+	{RF95W_REG_FSK_RSSITHRESH, "RegRssiThresh", pageFSK, nil},
+	{RF95W_REG_FSK_RSSIVALUE, "RegRssiValue", pageFSK, nil},
+	{RF95W_REG_FSK_RXBW, "RegRxBw", pageFSK, []*RFM95W_Field{RF95W_FIELD_RXBWMANT, RF95W_FIELD_RXBWEXP}},
+	{RF95W_REG_FSK_AFCBW, "RegAfcBw", pageFSK, []*RFM95W_Field{regField("RxBwMantAfc", RF95W_REG_FSK_AFCBW, pageFSK, 3, 2), regField("RxBwExpAfc", RF95W_REG_FSK_AFCBW, pageFSK, 0, 3)}},
+	{RF95W_REG_FSK_OOKPEAK, "RegOokPeak", pageFSK, []*RFM95W_Field{RF95W_FIELD_BITSYNCON, RF95W_FIELD_OOKTHRESHTYPE, regField("OokPeakThreshStep", RF95W_REG_FSK_OOKPEAK, pageFSK, 0, 3)}},
+	{RF95W_REG_FSK_OOKFIX, "RegOokFix", pageFSK, nil},
+	{RF95W_REG_FSK_OOKAVG, "RegOokAvg", pageFSK, []*RFM95W_Field{regField("OokPeakThreshDec", RF95W_REG_FSK_OOKAVG, pageFSK, 5, 3), regField("OokAverageOffset", RF95W_REG_FSK_OOKAVG, pageFSK, 2, 2), regField("OokAverageThreshFilt", RF95W_REG_FSK_OOKAVG, pageFSK, 0, 2)}},
+	{RF95W_REG_FSK_AFCFEI, "RegAfcFei", pageFSK, regFlags(RF95W_REG_FSK_AFCFEI, pageFSK, "", "", "", "AgcStart", "", "", "AfcClear", "AfcAutoClearOn")},
+	{RF95W_REG_FSK_AFCMSB, "RegAfcMsb", pageFSK, nil},
+	{RF95W_REG_FSK_AFCLSB, "RegAfcLsb", pageFSK, nil},
+	{RF95W_REG_FSK_FEIMSB, "RegFeiMsb", pageFSK, nil},
+	{RF95W_REG_FSK_FEILSB, "RegFeiLsb", pageFSK, nil},
+	{RF95W_REG_FSK_PREAMBLEDETECT, "RegPreambleDetect", pageFSK, []*RFM95W_Field{regField("PreambleDetectorOn", RF95W_REG_FSK_PREAMBLEDETECT, pageFSK, 7, 1), regField("PreambleDetectorSize", RF95W_REG_FSK_PREAMBLEDETECT, pageFSK, 5, 2), regField("PreambleDetectorTol", RF95W_REG_FSK_PREAMBLEDETECT, pageFSK, 0, 5)}},
+	{RF95W_REG_FSK_RXTIMEOUT1, "RegRxTimeout1", pageFSK, nil},
+	{RF95W_REG_FSK_RXTIMEOUT2, "RegRxTimeout2", pageFSK, nil},
+	{RF95W_REG_FSK_RXTIMEOUT3, "RegRxTimeout3", pageFSK, nil},
+	{RF95W_REG_FSK_RXDELAY, "RegRxDelay", pageFSK, nil},
+	{RF95W_REG_FSK_OSC, "RegOsc", pageFSK, []*RFM95W_Field{regField("RcCalStart", RF95W_REG_FSK_OSC, pageFSK, 3, 1), regField("ClkOut", RF95W_REG_FSK_OSC, pageFSK, 0, 3)}},
+	{RF95W_REG_FSK_PREAMBLEMSB, "RegPreambleMsb", pageFSK, nil},
+	{RF95W_REG_FSK_PREAMBLELSB, "RegPreambleLsb", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCCONFIG, "RegSyncConfig", pageFSK, []*RFM95W_Field{RF95W_FIELD_AUTORESTARTRXMODE, regField("PreamblePolarity", RF95W_REG_FSK_SYNCCONFIG, pageFSK, 5, 1), RF95W_FIELD_SYNCON, RF95W_FIELD_SYNCSIZE}},
+	{RF95W_REG_FSK_SYNCVALUE1, "RegSyncValue1", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCVALUE1 + 1, "RegSyncValue2", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCVALUE1 + 2, "RegSyncValue3", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCVALUE1 + 3, "RegSyncValue4", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCVALUE1 + 4, "RegSyncValue5", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCVALUE1 + 5, "RegSyncValue6", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCVALUE1 + 6, "RegSyncValue7", pageFSK, nil},
+	{RF95W_REG_FSK_SYNCVALUE1 + 7, "RegSyncValue8", pageFSK, nil},
+	{RF95W_REG_FSK_PACKETCONFIG1, "RegPacketConfig1", pageFSK, []*RFM95W_Field{RF95W_FIELD_PACKETFORMAT, RF95W_FIELD_DCFREE, RF95W_FIELD_CRCON, RF95W_FIELD_CRCAUTOCLEAROFF, RF95W_FIELD_ADDRESSFILTERING, regField("CrcWhiteningType", RF95W_REG_FSK_PACKETCONFIG1, pageFSK, 0, 1)}},
+	{RF95W_REG_FSK_PACKETCONFIG2, "RegPacketConfig2", pageFSK, []*RFM95W_Field{RF95W_FIELD_DATAMODE, regField("IoHomeOn", RF95W_REG_FSK_PACKETCONFIG2, pageFSK, 5, 1), regField("IoHomePowerFrame", RF95W_REG_FSK_PACKETCONFIG2, pageFSK, 4, 1), regField("BeaconOn", RF95W_REG_FSK_PACKETCONFIG2, pageFSK, 3, 1), RF95W_FIELD_PAYLOADLENGTHMSB}},
+	{RF95W_REG_FSK_PAYLOADLENGTH, "RegPayloadLength", pageFSK, nil},
+	{RF95W_REG_FSK_NODEADRS, "RegNodeAdrs", pageFSK, nil},
+	{RF95W_REG_FSK_BROADCASTADRS, "RegBroadcastAdrs", pageFSK, nil},
+	{RF95W_REG_FSK_FIFOTHRESH, "RegFifoThresh", pageFSK, []*RFM95W_Field{RF95W_FIELD_TXSTARTCONDITION, regField("FifoThreshold", RF95W_REG_FSK_FIFOTHRESH, pageFSK, 0, 6)}},
+	{RF95W_REG_FSK_SEQCONFIG1, "RegSeqConfig1", pageFSK, nil},
+	{RF95W_REG_FSK_SEQCONFIG2, "RegSeqConfig2", pageFSK, nil},
+	{RF95W_REG_FSK_TIMERRESOL, "RegTimerResol", pageFSK, []*RFM95W_Field{regField("Timer1Resolution", RF95W_REG_FSK_TIMERRESOL, pageFSK, 2, 2), regField("Timer2Resolution", RF95W_REG_FSK_TIMERRESOL, pageFSK, 0, 2)}},
+	{RF95W_REG_FSK_TIMER1COEF, "RegTimer1Coef", pageFSK, nil},
+	{RF95W_REG_FSK_TIMER2COEF, "RegTimer2Coef", pageFSK, nil},
+	{RF95W_REG_FSK_IMAGECAL, "RegImageCal", pageFSK, []*RFM95W_Field{regField("AutoImageCalOn", RF95W_REG_FSK_IMAGECAL, pageFSK, 7, 1), RF95W_FIELD_IMAGECALSTART, RF95W_FIELD_IMAGECALRUNNING, regField("TempChange", RF95W_REG_FSK_IMAGECAL, pageFSK, 3, 1), regField("TempThreshold", RF95W_REG_FSK_IMAGECAL, pageFSK, 1, 2), RF95W_FIELD_TEMPMONITOROFF}},
+	{RF95W_REG_FSK_TEMP, "RegTemp", pageFSK, nil},
+	{RF95W_REG_FSK_LOWBAT, "RegLowBat", pageFSK, []*RFM95W_Field{regField("LowBatOn", RF95W_REG_FSK_LOWBAT, pageFSK, 3, 1), regField("LowBatTrim", RF95W_REG_FSK_LOWBAT, pageFSK, 0, 3)}},
+	{RF95W_REG_FSK_IRQFLAGS1, "RegIrqFlags1", pageFSK, regFlags(RF95W_REG_FSK_IRQFLAGS1, pageFSK, "ModeReady", "RxReady", "TxReady", "PllLock", "Rssi", "Timeout", "PreambleDetect", "SyncAddressMatch")},
+	{RF95W_REG_FSK_IRQFLAGS2, "RegIrqFlags2", pageFSK, regFlags(RF95W_REG_FSK_IRQFLAGS2, pageFSK, "FifoFull", "FifoEmpty", "FifoLevel", "FifoOverrun", "PacketSent", "PayloadReady", "CrcOk", "LowBat")},
+
+	{RF95W_REG_DIOMAPPING1, "RegDioMapping1", pageCommon, []*RFM95W_Field{RF95W_FIELD_DIO0MAPPING, RF95W_FIELD_DIO1MAPPING, RF95W_FIELD_DIO2MAPPING, RF95W_FIELD_DIO3MAPPING}},
+	{RF95W_REG_DIOMAPPING2, "RegDioMapping2", pageCommon, []*RFM95W_Field{RF95W_FIELD_DIO4MAPPING, RF95W_FIELD_DIO5MAPPING, RF95W_FIELD_MAPPREAMBLEDETECT}},
+	{RF95W_REG_VERSION, "RegVersion", pageCommon, []*RFM95W_Field{regField("FullRevision", RF95W_REG_VERSION, pageCommon, 4, 4), regField("MetalMaskRevision", RF95W_REG_VERSION, pageCommon, 0, 4)}},
+	{RF95W_REG_PLLHOP, "RegPllHop", pageCommon, []*RFM95W_Field{regField("FastHopOn", RF95W_REG_PLLHOP, pageFSK, 7, 1)}},
+	{RF95W_REG_TCXO, "RegTcxo", pageCommon, []*RFM95W_Field{regField("TcxoInputOn", RF95W_REG_TCXO, pageCommon, 4, 1)}},
+	{RF95W_REG_PADAC, "RegPaDac", pageCommon, []*RFM95W_Field{RF95W_FIELD_PADAC}},
+	{RF95W_REG_FORMERTEMP, "RegFormerTemp", pageCommon, nil},
+	{RF95W_REG_BITRATEFRAC, "RegBitRateFrac", pageCommon, []*RFM95W_Field{regField("BitRateFrac", RF95W_REG_BITRATEFRAC, pageFSK, 0, 4)}},
+	{RF95W_REG_AGCREF, "RegAgcRef", pageCommon, []*RFM95W_Field{regField("AgcReferenceLevel", RF95W_REG_AGCREF, pageCommon, 0, 6)}},
+	{RF95W_REG_AGCTHRESH1, "RegAgcThresh1", pageCommon, []*RFM95W_Field{regField("AgcStep1", RF95W_REG_AGCTHRESH1, pageCommon, 0, 5)}},
+	{RF95W_REG_AGCTHRESH2, "RegAgcThresh2", pageCommon, []*RFM95W_Field{regField("AgcStep2", RF95W_REG_AGCTHRESH2, pageCommon, 4, 4), regField("AgcStep3", RF95W_REG_AGCTHRESH2, pageCommon, 0, 4)}},
+	{RF95W_REG_AGCTHRESH3, "RegAgcThresh3", pageCommon, []*RFM95W_Field{regField("AgcStep4", RF95W_REG_AGCTHRESH3, pageCommon, 4, 4), regField("AgcStep5", RF95W_REG_AGCTHRESH3, pageCommon, 0, 4)}},
+	{RF95W_REG_PLL, "RegPll", pageCommon, []*RFM95W_Field{regField("PllBandwidth", RF95W_REG_PLL, pageCommon, 6, 2)}},
+}
+
+func (f *RFM95W_Field) mask() byte {
+	return byte((1<<f.Width)-1) << f.Shift
+}
+
+/*
+	Get().
+	 Extracts the field from a register value.
+*/
+
+func (f *RFM95W_Field) Get(regVal byte) byte {
+	return (regVal & f.mask()) >> f.Shift
+}
+
+/*
+	Set().
+	 Returns the register value with the field replaced by v.
+*/
+
+func (f *RFM95W_Field) Set(regVal, v byte) byte {
+	return (regVal &^ f.mask()) | ((v << f.Shift) & f.mask())
+}
+
+/*
+	Format().
+	 Field value as text, e.g. "Bw=9 (500 kHz)".
+*/
+
+func (f *RFM95W_Field) Format(v byte) string {
+	if name, ok := f.Values[v]; ok {
+		return fmt.Sprintf("%s=%d (%s)", f.Name, v, name)
+	}
+	return fmt.Sprintf("%s=%d", f.Name, v)
+}
+
+// Does the field apply in LoRa (or FSK/OOK) mode?
+func (f *RFM95W_Field) inMode(loRa bool) bool {
+	return f.Page == RF95W_PAGE_COMMON || (f.Page == RF95W_PAGE_LORA) == loRa
+}
+
+/*
+	GetField().
+	 Reads a bitfield. For fields on the LoRa or FSK page, the module must be in the matching mode.
+*/
+
+func (r *RFM95W) GetField(f *RFM95W_Field) (byte, error) {
+	val, err := r.GetRegister(f.Reg)
+	if err != nil {
+		return 0, err
+	}
+	return f.Get(val), nil
+}
+
+/*
+	SetField().
+	 Read-modify-write of a bitfield. Returns an error if v does not fit in the field.
+*/
+
+func (r *RFM95W) SetField(f *RFM95W_Field, v byte) error {
+	if v > f.mask()>>f.Shift {
+		return fmt.Errorf("SetField(): value %d out of range for %s.", v, f.Name)
+	}
+	// Get initial value.
+	val, err := r.GetRegister(f.Reg)
+	if err != nil {
+		return err
+	}
+	new_val := f.Set(val, v)
+	if r.Debug {
+		fmt.Printf("SetField(%s): %02x -> %02x\n", f.Name, val, new_val)
+	}
+	_, err = r.SetRegister(f.Reg, new_val)
+	return err
+}
+
+/*
+	GetFlag().
+	 Reads a single bit field.
+*/
+
+func (r *RFM95W) GetFlag(f *RFM95W_Field) (bool, error) {
+	v, err := r.GetField(f)
+	return v != 0, err
+}
+
+/*
+	SetFlag().
+	 Sets or clears a single bit field.
+*/
+
+func (r *RFM95W) SetFlag(f *RFM95W_Field, on bool) error {
+	var v byte
+	if on {
+		v = 1
+	}
+	return r.SetField(f, v)
+}
+
+/*
+	RFM95W_RegisterDump.
+	 Snapshot of the register file, taken by DumpRegisters().
+*/
+
+type RFM95W_RegisterDump struct {
+	Time   time.Time
+	LoRa   bool                   // Taken in LoRa mode. Field decoding depends on the mode.
+	Values []RFM95W_RegisterValue // In RFM95W_Registers order.
+}
+
+type RFM95W_RegisterValue struct {
+	Register *RFM95W_Register
+	Value    byte
+}
+
+/*
+	RFM95W_RegisterChange.
+	 A register that differs between two dumps.
+*/
+
+type RFM95W_RegisterChange struct {
+	Register *RFM95W_Register
+	Old      byte
+	New      byte
+	LoRa     bool
+}
+
+/*
+	DumpRegisters().
+	 Reads all registers (except RegFifo). In LoRa mode, the FSK page is read by briefly setting AccessSharedReg.
+	 In FSK/OOK mode the LoRa page can't be read and is left out. Stop the queue handler first for a consistent
+	 snapshot.
+*/
+
+func (r *RFM95W) DumpRegisters() (*RFM95W_RegisterDump, error) {
+	r.mu_Send.Lock()
+	defer r.mu_Send.Unlock()
+
+	// RegOpMode to RegPll in one burst.
+	regs, err := r.GetBytes(RF95W_REG_OPMODE, RF95W_REG_PLL)
+	if err != nil {
+		return nil, err
+	}
+	opMode := regs[0]
+	get := func(addr byte) byte { return regs[addr-RF95W_REG_OPMODE] }
+
+	ret := &RFM95W_RegisterDump{
+		Time: time.Now(),
+		LoRa: RF95W_FIELD_LONGRANGEMODE.Get(opMode) != 0,
+	}
+	fskPage := regs
+	if ret.LoRa {
+		// Switch to the FSK page to read it, then back.
+		_, err = r.SetRegister(RF95W_REG_OPMODE, RF95W_FIELD_ACCESSSHAREDREG.Set(opMode, 1))
+		if err != nil {
+			return nil, err
+		}
+		fskPage, err = r.GetBytes(RF95W_REG_OPMODE, RF95W_REG_FSK_IRQFLAGS2)
+		r.SetRegister(RF95W_REG_OPMODE, opMode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range RFM95W_Registers {
+		reg := &RFM95W_Registers[i]
+		var val byte
+		switch reg.Page {
+		case RF95W_PAGE_COMMON:
+			val = get(reg.Addr)
+		case RF95W_PAGE_LORA:
+			if !ret.LoRa {
+				continue
+			}
+			val = get(reg.Addr)
+		case RF95W_PAGE_FSK:
+			val = fskPage[reg.Addr-RF95W_REG_OPMODE]
+		}
+		ret.Values = append(ret.Values, RFM95W_RegisterValue{Register: reg, Value: val})
+	}
+	return ret, nil
+}
+
+// Fields of the register that apply in LoRa (or FSK/OOK) mode. Only common registers have mode dependent fields.
+func (reg *RFM95W_Register) fields(loRa bool) []*RFM95W_Field {
+	if reg.Page != RF95W_PAGE_COMMON {
+		return reg.Fields
+	}
+	ret := make([]*RFM95W_Field, 0, len(reg.Fields))
+	for _, f := range reg.Fields {
+		if f.inMode(loRa) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+/*
+	FieldValues().
+	 Decodes a register value into its fields, skipping the ones that don't apply in the given mode.
+*/
+
+func (reg *RFM95W_Register) FieldValues(val byte, loRa bool) []string {
+	ret := make([]string, 0, len(reg.Fields))
+	for _, f := range reg.fields(loRa) {
+		ret = append(ret, f.Format(f.Get(val)))
+	}
+	return ret
+}
+
+func (reg *RFM95W_Register) label() string {
+	switch reg.Page {
+	case RF95W_PAGE_LORA:
+		return fmt.Sprintf("0x%02X %s (LoRa)", reg.Addr, reg.Name)
+	case RF95W_PAGE_FSK:
+		return fmt.Sprintf("0x%02X %s (FSK)", reg.Addr, reg.Name)
+	}
+	return fmt.Sprintf("0x%02X %s", reg.Addr, reg.Name)
+}
+
+/*
+	String().
+	 One line per register, with the decoded fields.
+*/
+
+func (d *RFM95W_RegisterDump) String() string {
+	var buf bytes.Buffer
+	for _, v := range d.Values {
+		fmt.Fprintf(&buf, "%-36s = 0x%02X", v.Register.label(), v.Value)
+		for _, f := range v.Register.FieldValues(v.Value, d.LoRa) {
+			fmt.Fprintf(&buf, "  %s", f)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+/*
+	Get().
+	 Value of a register in the dump. Returns false if the register was not read.
+*/
+
+func (d *RFM95W_RegisterDump) Get(page int, addr byte) (byte, bool) {
+	for _, v := range d.Values {
+		if v.Register.Page == page && v.Register.Addr == addr {
+			return v.Value, true
+		}
+	}
+	return 0, false
+}
+
+/*
+	Diff().
+	 Returns the registers that changed from d to other. Registers missing from either dump are skipped.
+*/
+
+func (d *RFM95W_RegisterDump) Diff(other *RFM95W_RegisterDump) []RFM95W_RegisterChange {
+	old := make(map[*RFM95W_Register]byte)
+	for _, v := range d.Values {
+		old[v.Register] = v.Value
+	}
+	ret := make([]RFM95W_RegisterChange, 0)
+	for _, v := range other.Values {
+		o, ok := old[v.Register]
+		if !ok || o == v.Value {
+			continue
+		}
+		ret = append(ret, RFM95W_RegisterChange{Register: v.Register, Old: o, New: v.Value, LoRa: other.LoRa})
+	}
+	return ret
+}
+
+/*
+	String().
+	 The register and each field that changed.
+*/
+
+func (c RFM95W_RegisterChange) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: 0x%02X -> 0x%02X", c.Register.label(), c.Old, c.New)
+	for _, f := range c.Register.fields(c.LoRa) {
+		o, n := f.Get(c.Old), f.Get(c.New)
+		if o != n {
+			fmt.Fprintf(&buf, "  %s -> %s", f.Format(o), f.Format(n))
+		}
+	}
+	return buf.String()
+}
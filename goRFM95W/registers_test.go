@@ -0,0 +1,71 @@
+package goRFM95W
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	f := RF95W_FIELD_CODINGRATE
+	if v := f.Get(0x72); v != 1 {
+		t.Fatalf("CodingRate of 0x72 is %d, expected 1.", v)
+	}
+	if v := f.Set(0x72, 4); v != 0x78 {
+		t.Fatalf("Setting CodingRate 4 in 0x72 gives %02x, expected 78.", v)
+	}
+	if v := RF95W_FIELD_SPREADINGFACTOR.Set(0x74, 12); v != 0xC4 {
+		t.Fatalf("Setting SpreadingFactor 12 in 0x74 gives %02x, expected c4.", v)
+	}
+}
+
+func TestGetSetField(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	if err := r.SetField(RF95W_FIELD_SPREADINGFACTOR, 10); err != nil {
+		t.Fatal(err)
+	}
+	if v := e.Register(RF95W_REG_MODEMCONFIG2); v>>4 != 10 {
+		t.Fatalf("RegModemConfig2 %02x, expected SF10.", v)
+	}
+	if v, err := r.GetField(RF95W_FIELD_SPREADINGFACTOR); err != nil || v != 10 {
+		t.Fatalf("GetField() returned %d, %v.", v, err)
+	}
+	if err := r.SetFlag(RF95W_FIELD_LOWDATARATEOPTIMIZE, true); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := r.GetFlag(RF95W_FIELD_LOWDATARATEOPTIMIZE); err != nil || !on {
+		t.Fatalf("GetFlag() returned %t, %v.", on, err)
+	}
+}
+
+func TestDumpRegisters(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	d1, err := r.DumpRegisters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d1.String(), "RegModemConfig1") {
+		t.Fatalf("Dump does not list RegModemConfig1:\n%s", d1)
+	}
+	// The FSK page is read through AccessSharedReg, which is switched back afterwards.
+	if v, ok := d1.Get(RF95W_PAGE_FSK, RF95W_REG_FSK_IMAGECAL); !ok || v != 0x02 {
+		t.Fatalf("RegImageCal %02x, %t.", v, ok)
+	}
+	if e.Register(RF95W_REG_OPMODE)&0x40 != 0 {
+		t.Fatal("AccessSharedReg left set.")
+	}
+
+	if err := r.SetBandwidth(125000); err != nil {
+		t.Fatal(err)
+	}
+	d2, err := r.DumpRegisters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changed []string
+	for _, c := range d1.Diff(d2) {
+		changed = append(changed, c.Register.Name)
+	}
+	if len(changed) == 0 || !strings.Contains(strings.Join(changed, " "), "RegModemConfig1") {
+		t.Fatalf("Diff %v, expected RegModemConfig1.", changed)
+	}
+}
@@ -0,0 +1,179 @@
+// RSSI measurement and spectrum scanning.
+
+package goRFM95W
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	RF95W_RSSI_OFFSET_HF = -157 // dBm. RSSI = offset + RegRssiValue, HF port (band 1).
+	RF95W_RSSI_OFFSET_LF = -164 // dBm. LF port (bands 2 and 3).
+
+	RF95W_SCAN_SETTLE          = 1 * time.Millisecond // Wait after retuning, before the first RSSI sample.
+	RF95W_SCAN_SAMPLE_INTERVAL = 1 * time.Millisecond
+)
+
+/*
+	RFM95W_RSSISample.
+	 Received power at one frequency of a ScanRSSI() sweep.
+*/
+
+type RFM95W_RSSISample struct {
+	Frequency uint64 // Hz.
+	RSSI      int    // dBm. Average over the dwell time.
+	Peak      int    // dBm. Highest sample over the dwell time.
+}
+
+/*
+	rssiOffset().
+	 Offset for converting RSSI register values to dBm, which depends on the band.
+*/
+
+func (r *RFM95W) rssiOffset() int {
+	if r.lowFrequency {
+		return RF95W_RSSI_OFFSET_LF
+	}
+	return RF95W_RSSI_OFFSET_HF
+}
+
+/*
+	packetRSSI().
+	 Converts RegPktRssiValue and RegPktSnrValue to the packet RSSI (dBm), the signal strength (dBm) and the SNR (dB).
+	 Above the noise floor the signal strength has a 16/15 linearity correction, below it the (negative) SNR is
+	 added to the packet RSSI.
+*/
+
+func (r *RFM95W) packetRSSI(rssiByte, snrByte byte) (int, float64, float64) {
+	snr := float64(int8(snrByte)) / 4
+	rssi := r.rssiOffset() + int(rssiByte)
+	if snr < 0 {
+		return rssi, float64(rssi) + snr, snr
+	}
+	return rssi, float64(r.rssiOffset()) + float64(rssiByte)*16/15, snr
+}
+
+/*
+	CurrentRSSI().
+	 Returns the current received power (dBm) on the channel, e.g. for sampling the noise floor between packets.
+	 This runs through queueHandler, between TX and received packets. If the module isn't receiving, e.g. right
+	 after TX, it is switched to RXCONTINUOUS first.
+*/
+
+func (r *RFM95W) CurrentRSSI() (int, error) {
+	var rssi int
+	err := r.runJob(func() error {
+		r.mu_Send.Lock()
+		defer r.mu_Send.Unlock()
+
+		if r.currentMode != RF95W_MODE_RXCONTINUOUS {
+			err := r.SetMode(RF95W_MODE_RXCONTINUOUS)
+			if err != nil {
+				return err
+			}
+			time.Sleep(RF95W_SCAN_SETTLE)
+		}
+		var err error
+		rssi, err = r.currentRSSI()
+		return err
+	})
+	return rssi, err
+}
+
+/*
+	currentRSSI().
+	 Reads RegRssiValue. Only valid while receiving. FSK: RegRssiValue is -RSSI * 2.
+*/
+
+func (r *RFM95W) currentRSSI() (int, error) {
+	if !r.isLoRa() {
+		val, err := r.GetRegister(RF95W_REG_FSK_RSSIVALUE)
+		return -int(val) / 2, err
+	}
+	val, err := r.GetRegister(RF95W_REG_RSSIVALUE)
+	if err != nil {
+		return 0, err
+	}
+	return r.rssiOffset() + int(val), nil
+}
+
+/*
+	ScanRSSI().
+	 Sweeps the receiver from start to stop (Hz) in steps of step, sampling RegRssiValue for dwell at each frequency,
+	 with the current bandwidth. TX is held off during the scan. Afterwards the module is tuned back to the
+	 configured frequency and goes back to receiving.
+*/
+
+func (r *RFM95W) ScanRSSI(start, stop, step uint64, dwell time.Duration) ([]RFM95W_RSSISample, error) {
+	if step == 0 || start > stop {
+		return nil, errors.New("Invalid scan range requested.")
+	}
+	for _, freq := range []uint64{start, stop} {
+		err := checkFrequency(r.variant, freq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ret []RFM95W_RSSISample
+	err := r.runJob(func() error {
+		r.mu_Send.Lock()
+		defer r.mu_Send.Unlock()
+
+		var err error
+		ret, err = r.scanRSSI(start, stop, step, dwell)
+		// Back to the configured frequency. Discard anything received during the scan.
+		r.SetMode(RF95W_MODE_STDBY)
+		r.setFrf(r.settings.Frequency)
+		r.clearIRQFlags(0xFF)
+		return err
+	})
+	return ret, err
+}
+
+/*
+	scanRSSI().
+	 The sweep itself. The caller restores the frequency and mode.
+*/
+
+func (r *RFM95W) scanRSSI(start, stop, step uint64, dwell time.Duration) ([]RFM95W_RSSISample, error) {
+	var ret []RFM95W_RSSISample
+	for freq := start; freq <= stop; freq += step {
+		err := r.SetMode(RF95W_MODE_STDBY)
+		if err != nil {
+			return ret, err
+		}
+		err = r.setFrf(freq)
+		if err != nil {
+			return ret, err
+		}
+		err = r.SetMode(RF95W_MODE_RXCONTINUOUS)
+		if err != nil {
+			return ret, err
+		}
+		time.Sleep(RF95W_SCAN_SETTLE)
+
+		sample := RFM95W_RSSISample{Frequency: freq}
+		var sum, n int
+		end := time.Now().Add(dwell)
+		for {
+			rssi, err := r.currentRSSI()
+			if err != nil {
+				return ret, err
+			}
+			if n == 0 || rssi > sample.Peak {
+				sample.Peak = rssi
+			}
+			sum += rssi
+			n++
+			if !time.Now().Before(end) {
+				break
+			}
+			time.Sleep(RF95W_SCAN_SAMPLE_INTERVAL)
+		}
+		sample.RSSI = sum / n
+		ret = append(ret, sample)
+	}
+	return ret, nil
+}
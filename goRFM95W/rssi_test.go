@@ -0,0 +1,93 @@
+package goRFM95W
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanRSSI(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	e.Spectrum = func(freq uint64) int {
+		if freq > 914900000 && freq < 915100000 {
+			return -60
+		}
+		return -120
+	}
+	startReceiving(t, r, e)
+	// A message sent during the scan is transmitted after it.
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		r.Send([]byte("x"))
+	}()
+	res, err := r.ScanRSSI(914000000, 916000000, 500000, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 5 || res[2].Frequency != 915000000 || res[2].RSSI != -60 || res[0].Peak != -120 {
+		t.Fatalf("Scan %+v.", res)
+	}
+	waitTransmitted(t, e, 1)
+	// The scan leaves the frequency and mode as they were.
+	waitFor(t, "RXCONTINUOUS after scan", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+	if v := frf(e); v != 0xE4C000 {
+		t.Fatalf("RegFrf %06x after scan, expected e4c000.", v)
+	}
+
+	if _, err := r.ScanRSSI(400000000, 914100000, 100000, 0); err == nil {
+		t.Fatal("Scan outside the band accepted.")
+	}
+}
+
+func TestScanRSSIStopped(t *testing.T) {
+	r, _ := newTestModule(t, nil)
+	res, err := r.ScanRSSI(914000000, 914100000, 100000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("Scan %+v, expected 2 samples.", res)
+	}
+}
+
+func TestPacketRSSI(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	startReceiving(t, r, e)
+	// Below the noise floor the signal strength is RSSI + SNR.
+	if err := e.Receive(EmulatorPacket{Payload: []byte("a"), RSSI: -110, SNR: -10}); err != nil {
+		t.Fatal(err)
+	}
+	if m := waitReceived(t, r, 1)[0]; m.RSSI != -110 || m.SNR != -10 || m.SignalRSSI != -120 {
+		t.Fatalf("Received %+v.", m)
+	}
+	// Above it, RegPktRssiValue is corrected by 16/15.
+	if err := e.Receive(EmulatorPacket{Payload: []byte("b"), RSSI: -67, SNR: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if m := waitReceived(t, r, 1)[0]; m.RSSI != -67 || m.SNR != 8 || m.SignalRSSI != -157+90.0*16/15 {
+		t.Fatalf("Received %+v.", m)
+	}
+}
+
+func TestCurrentRSSI(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	e.Spectrum = func(uint64) int { return -118 }
+	startReceiving(t, r, e)
+	if v, err := r.CurrentRSSI(); err != nil || v != -118 {
+		t.Fatalf("CurrentRSSI() returned %d, %v.", v, err)
+	}
+}
+
+func TestCurrentRSSIStandby(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	e.Spectrum = func(uint64) int { return -118 }
+	if err := r.SetMode(RF95W_MODE_STDBY); err != nil {
+		t.Fatal(err)
+	}
+	// Without the queue handler, the module is put in RX for the reading.
+	if v, err := r.CurrentRSSI(); err != nil || v != -118 {
+		t.Fatalf("CurrentRSSI() returned %d, %v.", v, err)
+	}
+	if e.Mode() != RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS {
+		t.Fatalf("RegOpMode %02x, expected RXCONTINUOUS.", e.Mode())
+	}
+}
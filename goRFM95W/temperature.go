@@ -0,0 +1,84 @@
+// Temperature sensor.
+
+package goRFM95W
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	RF95W_TEMP_MEASURE_TIME   = 150 * time.Microsecond // Time in FSRX for the sensor to take a reading.
+	RF95W_IMAGECAL_TEMP_DRIFT = 10                     // °C. Recalibrate the image when the temperature moves further than this.
+)
+
+/*
+	ReadTemperature().
+	 Reads the on-chip temperature sensor (°C), with TemperatureOffset added. The sensor is only reachable in FSK
+	 mode, so the module is switched to FSK STDBY and back to LoRa, and receiving again afterwards. This runs through
+	 queueHandler so that it doesn't interrupt TX or a packet being received. If the temperature drifted more than
+	 RF95W_IMAGECAL_TEMP_DRIFT since the last image calibration, the image is recalibrated.
+*/
+
+func (r *RFM95W) ReadTemperature() (int, error) {
+	var temp int
+	err := r.runJob(func() error {
+		r.mu_Send.Lock()
+		defer r.mu_Send.Unlock()
+
+		return r.inFSKStandby(func() error {
+			var err error
+			temp, err = r.measureTemperature()
+			if err != nil {
+				return err
+			}
+			drift := temp - r.imageCalTemp
+			if r.imageCalFreq != 0 && (drift > RF95W_IMAGECAL_TEMP_DRIFT || drift < -RF95W_IMAGECAL_TEMP_DRIFT) {
+				if r.Debug {
+					fmt.Printf("ReadTemperature(): drifted %d C since the image calibration, recalibrating.\n", drift)
+				}
+				return r.calibrateImage()
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return temp + r.TemperatureOffset, nil
+}
+
+/*
+	measureTemperature().
+	 Takes a reading in FSK STDBY mode: the sensor measures while the module is in FSRX with TempMonitorOff cleared.
+	 Returns the uncalibrated temperature (°C). RegTemp is -1 °C per LSB.
+*/
+
+func (r *RFM95W) measureTemperature() (int, error) {
+	monitorOff, err := r.GetFlag(RF95W_FIELD_TEMPMONITOROFF)
+	if err != nil {
+		return 0, err
+	}
+	err = r.SetFlag(RF95W_FIELD_TEMPMONITOROFF, false)
+	if err != nil {
+		return 0, err
+	}
+	err = r.SetMode(RF95W_MODE_FSRX)
+	if err != nil {
+		return 0, err
+	}
+	time.Sleep(RF95W_TEMP_MEASURE_TIME)
+	err = r.SetFlag(RF95W_FIELD_TEMPMONITOROFF, monitorOff)
+	if err != nil {
+		return 0, err
+	}
+	err = r.SetMode(RF95W_MODE_STDBY)
+	if err != nil {
+		return 0, err
+	}
+	val, err := r.GetRegister(RF95W_REG_FSK_TEMP)
+	if err != nil {
+		return 0, err
+	}
+	return -int(int8(val)), nil
+}
@@ -0,0 +1,43 @@
+package goRFM95W
+
+import (
+	"testing"
+)
+
+func TestReadTemperature(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	e.Temperature = 25
+	r.TemperatureOffset = 2
+	startReceiving(t, r, e)
+
+	if temp, err := r.ReadTemperature(); err != nil || temp != 27 {
+		t.Fatalf("ReadTemperature() returned %d, %v, expected 27.", temp, err)
+	}
+	waitFor(t, "RXCONTINUOUS after ReadTemperature()", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+
+	// A drift of more than RF95W_IMAGECAL_TEMP_DRIFT repeats the image calibration.
+	e.Temperature = 40
+	if temp, err := r.ReadTemperature(); err != nil || temp != 42 {
+		t.Fatalf("ReadTemperature() returned %d, %v, expected 42.", temp, err)
+	}
+	if r.imageCalTemp != 40 {
+		t.Fatalf("Image calibrated at %d C, expected 40 C.", r.imageCalTemp)
+	}
+	waitFor(t, "RXCONTINUOUS after ReadTemperature()", func() bool { return e.Mode() == RF95W_MODE_LORA|RF95W_MODE_RXCONTINUOUS })
+
+	// TX still works afterwards.
+	if err := r.Send([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	waitTransmitted(t, e, 1)
+}
+
+func TestReadTemperatureError(t *testing.T) {
+	r, e := newTestModule(t, nil)
+	e.Temperature = 25
+	r.TemperatureOffset = 2
+	e.Close()
+	if temp, err := r.ReadTemperature(); err == nil || temp != 0 {
+		t.Fatalf("ReadTemperature() on a closed bus returned %d, %v.", temp, err)
+	}
+}